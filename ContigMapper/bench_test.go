@@ -0,0 +1,75 @@
+package main
+
+import (
+	"ContigMapping"
+	"bytes"
+	"io"
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+// Sizes of the synthetic inputs, in markers
+var benchSizes = []int{10000, 100000, 1000000}
+
+// Simulated map and marker files of each size, generated once
+var benchInputs = make(map[int][2][]byte)
+
+func benchInput(b *testing.B, markers int) (genMap, markerInfo []byte) {
+	if in, ok := benchInputs[markers]; ok {
+		return in[0], in[1]
+	}
+	p := ContigMapping.DefaultSimParams()
+	p.Chromosomes, p.ChromosomeLength, p.ContigLength = 10, 50000000, 100000
+	p.MarkerDensity = float64(markers) / (float64(p.Chromosomes) * float64(p.ChromosomeLength) / 1e6)
+	p.ErrorRate, p.ChimeraRate, p.MultiMapRate = 0.01, 0.01, 0.01
+	sim, err := ContigMapping.Simulate(p, rand.New(rand.NewSource(1)))
+	if err != nil {
+		b.Fatal(err)
+	}
+	var m, mi bytes.Buffer
+	if err := sim.WriteMap(&m); err != nil {
+		b.Fatal(err)
+	}
+	if err := sim.WriteMarkers(&mi); err != nil {
+		b.Fatal(err)
+	}
+	benchInputs[markers] = [2][]byte{m.Bytes(), mi.Bytes()}
+	return m.Bytes(), mi.Bytes()
+}
+
+// Parse, place and write the maps
+func BenchmarkPlace(b *testing.B) {
+	verbosity = 0
+	for _, n := range benchSizes {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			genMap, markers := benchInput(b, n)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				lgMap, _ := Load(io.NopCloser(bytes.NewReader(genMap)), io.NopCloser(bytes.NewReader(markers)), io.Discard)
+				if err := WriteContigMaps(mapWriter(io.Discard), lgMap, false); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// Write the maps already placed and filtered
+func BenchmarkWriteContigMaps(b *testing.B) {
+	verbosity = 0
+	for _, n := range benchSizes {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			genMap, markers := benchInput(b, n)
+			lgMap, _ := Load(io.NopCloser(bytes.NewReader(genMap)), io.NopCloser(bytes.NewReader(markers)), io.Discard)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := WriteContigMaps(mapWriter(io.Discard), lgMap, false); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,509 @@
+package main
+
+import (
+	"ContigMapping"
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Create a flag set for a command with its usage line and description
+func newFlagSet(name, usage, description string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.String("config", "", "Name of the configuration file (TOML, YAML or JSON) with the values of these flags. Flags in the command line override it")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: ContigMapper "+name+" "+usage)
+		fmt.Fprintln(os.Stderr, description+"\n\nFlags:")
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// Open the output given in a flag, or stdout if the name is empty or "-"
+func createOutput(flagName, name string) io.WriteCloser {
+	if name == "" {
+		name = "-"
+	}
+	checkOutput(flagName, name, false)
+	return createOutputFlag(flagName, name)
+}
+
+// Read the placement result file given in a flag, in the format of place, AGP or JSON
+func readResult(flagName, name string) (maps map[string]*ContigMapping.ContigMap, names []string) {
+	checkInput(flagName, name, true)
+	readInput(flagName, name, func(r io.Reader) (err error) {
+		maps, names, err = ContigMapping.ReadAnyResult(r)
+		return err
+	})
+	return maps, names
+}
+
+// Problems and counts found by validate in the map and marker files
+type validation struct {
+	problems   []string
+	mapMarkers map[string]string // LG of each marker of the map
+	// Unique markers of the marker file in the map and not in the map, and the contigs with markers
+	hit, missing, contigs map[string]bool
+}
+
+func newValidation() *validation {
+	return &validation{mapMarkers: make(map[string]string), hit: make(map[string]bool), missing: make(map[string]bool),
+		contigs: make(map[string]bool)}
+}
+
+// Run check on each line of r
+func scanLines(r io.Reader, check func(line int, text string)) error {
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		check(line, scanner.Text())
+	}
+	return scanner.Err()
+}
+
+// Check the genetic map. The lines are parsed as place does, but every problem is kept instead of stopping at the first
+func (v *validation) checkMap(name string, r io.Reader) error {
+	lg := ""
+	return scanLines(r, func(line int, text string) {
+		kind, marker, _, err := parseMapLine(text)
+		switch {
+		case err != nil:
+			v.problems = append(v.problems, fmt.Sprintf("%s:%d: %v", name, line, err))
+		case kind == mapGroup:
+			lg = marker
+		case kind == mapMarker:
+			if prev, ok := v.mapMarkers[marker]; ok {
+				v.problems = append(v.problems, fmt.Sprintf("%s:%d: marker %s already in LG %s", name, line, marker, prev))
+			}
+			v.mapMarkers[marker] = lg
+		}
+	})
+}
+
+// Check the marker file against the markers of the map read by checkMap
+func (v *validation) checkMarkers(name string, r io.Reader) error {
+	return scanLines(r, func(line int, text string) {
+		ml, err := parseMarkerLine(text)
+		switch {
+		case err != nil:
+			v.problems = append(v.problems, fmt.Sprintf("%s:%d: %v", name, line, err))
+			return
+		case ml.marker == "":
+			return
+		}
+		if _, ok := v.mapMarkers[ml.marker]; ok {
+			v.hit[ml.marker] = true
+		} else {
+			v.missing[ml.marker] = true
+		}
+		v.contigs[ml.contig] = true
+	})
+}
+
+// Check the format of the map and marker files, then report the markers and contigs that cannot be used
+func Validate(args []string) {
+	fs := newFlagSet("validate", "-map <file> -markers <file>", "Check the map and marker files and report the problems found.")
+	mapFile := fs.String("map", "", "Name of the file with the genetic map")
+	markerFile := fs.String("markers", "", "Name of the file with the marker information")
+	ParseFlags(fs, args)
+	checkInput("map", *mapFile, true)
+	checkInput("markers", *markerFile, true)
+	v := newValidation()
+	readInput("map", *mapFile, func(r io.Reader) error {
+		return v.checkMap(*mapFile, r)
+	})
+	readInput("markers", *markerFile, func(r io.Reader) error {
+		return v.checkMarkers(*markerFile, r)
+	})
+	for _, p := range v.problems {
+		fmt.Println(p)
+	}
+	fmt.Printf("Markers in the map: %d\n", len(v.mapMarkers))
+	fmt.Printf("Markers in the map hit on contigs: %d\n", len(v.hit))
+	fmt.Printf("Markers on contigs without map position: %d\n", len(v.missing))
+	fmt.Printf("Contigs with markers: %d\n", len(v.contigs))
+	if len(v.problems) > 0 {
+		fmt.Printf("%d problems found\n", len(v.problems))
+		os.Exit(exitInput)
+	}
+	fmt.Println("No problems found")
+}
+
+// Summarise a placement result per LG
+func Stats(args []string) {
+	fs := newFlagSet("stats", "-in <file> [-out <file>]", "Summarise a placement result per LG as a tab separated table.")
+	in := fs.String("in", "", "Name of the placement result file")
+	outfile := fs.String("out", "", "Name of the output file (default stdout)")
+	ParseFlags(fs, args)
+	maps, names := readResult("in", *in)
+	out := createOutput("out", *outfile)
+	defer closeOutput("out", out)
+	fmt.Fprint(out, runHeader.Comment("##"))
+	fmt.Fprintln(out, "LG\tContigs\tOriented\tUnoriented\tReference\tDeleted\tStart\tEnd\tSpan")
+	for _, name := range names {
+		contigs := maps[name].Ordered()
+		var oriented, ref int
+		for _, c := range contigs {
+			if c.Orientation != "" {
+				oriented++
+			}
+			if c.RefPlaced {
+				ref++
+			}
+		}
+		var start, end float64
+		if len(contigs) > 0 {
+			start, end = contigs[0].GenPos, contigs[len(contigs)-1].GenPos
+		}
+		fmt.Fprintf(out, "%s\t%d\t%d\t%d\t%d\t%d\t%s\t%s\t%s\n", name, len(contigs), oriented, len(contigs)-oriented, ref, maps[name].Deleted,
+			ContigMapping.FormatPos(start), ContigMapping.FormatPos(end), ContigMapping.FormatPos(end-start))
+	}
+}
+
+// Report the contigs that changed LG, order or orientation, appeared or disappeared between two placement results,
+// and how well the order of each LG agrees
+func Compare(args []string) {
+	fs := newFlagSet("compare", "-a <file> -b <file> [-threshold <n>] [-out <file>]",
+		"Report the differences between two placement results, in the format of place, AGP or JSON.\n"+
+			"Each difference is a line \"kind<TAB>contig<TAB>A<TAB>B\" where kind is disappeared, moved (LG),\n"+
+			"reordered (rank among the contigs of the LG in both), flipped or appeared.\n"+
+			"The Kendall tau between the orders of each LG follows as \"tau<TAB>LG<TAB>shared contigs<TAB>tau\".")
+	a := fs.String("a", "", "Name of the first placement result file")
+	b := fs.String("b", "", "Name of the second placement result file")
+	threshold := fs.Int("threshold", 0, "Number of places a contig can move inside its LG before it is reported as reordered")
+	outfile := fs.String("out", "", "Name of the output file (default stdout)")
+	ParseFlags(fs, args)
+	if *threshold < 0 {
+		fatal(exitUsage, "-threshold cannot be negative")
+	}
+	mapsA, namesA := readResult("a", *a)
+	mapsB, namesB := readResult("b", *b)
+	diffs, agreement := ContigMapping.Compare(mapsA, mapsB, namesA, namesB, *threshold)
+	out := createOutput("out", *outfile)
+	defer closeOutput("out", out)
+	fmt.Fprint(out, runHeader.Comment("##"))
+	for _, d := range diffs {
+		fmt.Fprintf(out, "%s\t%s\t%s\t%s\n", d.Kind, d.Contig, d.A, d.B)
+	}
+	for _, t := range agreement {
+		tau := "NA"
+		if t.Shared > 1 {
+			tau = strconv.FormatFloat(t.Tau, 'f', 4, 64)
+		}
+		fmt.Fprintf(out, "tau\t%s\t%d\t%s\n", t.LG, t.Shared, tau)
+	}
+}
+
+// Fraction as text, NA when there is nothing to count
+func fraction(n, total int) string {
+	if total == 0 {
+		return "NA"
+	}
+	return strconv.FormatFloat(float64(n)/float64(total), 'f', 4, 64)
+}
+
+// Evaluate a placement result against the alignment of the contigs to a reference assembly
+func Evaluate(args []string) {
+	fs := newFlagSet("evaluate", "-in <file> -paf <file> [-minq <n>] [-out <file>]",
+		"Evaluate a placement result (format of place, AGP or JSON) against the alignment of the contigs to a reference assembly.\n"+
+			"The output has a table with the accuracy of each LG and overall, followed by the misplaced contigs:\n"+
+			"on another chromosome, out of order (not in the longest increasing subsequence) or wrongly oriented.")
+	in := fs.String("in", "", "Name of the placement result file")
+	paf := fs.String("paf", "", "Name of the PAF file with the alignment of the contigs to the reference")
+	minQ := fs.Uint64("minq", 0, "Minimum mapping quality of the alignments")
+	outfile := fs.String("out", "", "Name of the output file (default stdout)")
+	ParseFlags(fs, args)
+	checkInput("paf", *paf, true)
+	maps, names := readResult("in", *in)
+	var alignments map[string]*ContigMapping.Alignment
+	readInput("paf", *paf, func(r io.Reader) (err error) {
+		alignments, err = ContigMapping.ReadPAF(r, *minQ)
+		return err
+	})
+	evaluation, misplaced := ContigMapping.Evaluate(maps, names, alignments)
+	out := createOutput("out", *outfile)
+	defer closeOutput("out", out)
+	fmt.Fprint(out, runHeader.Comment("##"))
+	fmt.Fprintln(out, "LG\tChromosome\tPlaced\tAligned\tOnChromosome\tCorrectChromosome\tInOrder\tLIS\tKendallTau\tReversed\tOriented\tCorrectOrientation\tOrientationAccuracy")
+	total := ContigMapping.Evaluation{LG: "total", Chromosome: "-"}
+	for _, e := range evaluation {
+		total.Placed += e.Placed
+		total.Aligned += e.Aligned
+		total.OnChromosome += e.OnChromosome
+		total.InOrder += e.InOrder
+		total.Oriented += e.Oriented
+		total.CorrectOrient += e.CorrectOrient
+	}
+	for _, e := range append(evaluation, total) {
+		tau, reversed := "NA", "-"
+		if e.LG != "total" {
+			reversed = strconv.FormatBool(e.Reversed)
+			if e.OnChromosome > 1 {
+				tau = strconv.FormatFloat(e.Tau, 'f', 4, 64)
+			}
+		}
+		fmt.Fprintf(out, "%s\t%s\t%d\t%d\t%d\t%s\t%d\t%s\t%s\t%s\t%d\t%d\t%s\n", e.LG, e.Chromosome, e.Placed, e.Aligned,
+			e.OnChromosome, fraction(e.OnChromosome, e.Aligned), e.InOrder, fraction(e.InOrder, e.OnChromosome), tau, reversed,
+			e.Oriented, e.CorrectOrient, fraction(e.CorrectOrient, e.Oriented))
+	}
+	fmt.Fprintln(out, "\nContig\tLG\tMisplacement\tReference")
+	for _, m := range misplaced {
+		fmt.Fprintf(out, "%s\t%s\t%s\t%s\n", m.Contig, m.LG, m.Kind, m.Detail)
+	}
+}
+
+// Convert a placement result to other formats
+func Export(args []string) {
+	fs := newFlagSet("export", "-in <file> -format "+strings.Join(ContigMapping.Formats, "|")+" [-lengths <file>] [-out <file>]", "Convert a placement result to other formats.")
+	in := fs.String("in", "", "Name of the placement result file")
+	format := fs.String("format", "tsv", "Output format: "+strings.Join(ContigMapping.Formats, ", ")+". agp and bed need -lengths")
+	lengths := fs.String("lengths", "", "Name of the file with the contig lengths (fasta index or name<TAB>length)")
+	outfile := fs.String("out", "", "Name of the output file (default stdout)")
+	ParseFlags(fs, args)
+	switch {
+	case !validFormat(*format):
+		fatal(exitUsage, "-format: unknown export format "+*format)
+	case ContigMapping.NeedsLengths(*format) && *lengths == "":
+		fatal(exitUsage, "-format "+*format+" needs the contig lengths (-lengths)")
+	}
+	checkInput("lengths", *lengths, false)
+	maps, names := readResult("in", *in)
+	if *lengths != "" {
+		var l map[string]uint64
+		readInput("lengths", *lengths, func(r io.Reader) (err error) {
+			l, err = ContigMapping.ReadLengths(r)
+			return err
+		})
+		for _, name := range names {
+			for _, c := range *maps[name].Contigs {
+				if n, ok := l[c.Name]; ok {
+					c.Length = n
+				}
+			}
+		}
+	}
+	out := createOutput("out", *outfile)
+	defer closeOutput("out", out)
+	w, err := ContigMapping.NewWriter(*format, out, runHeader)
+	if err != nil {
+		fatal(exitUsage, "-format: ", err)
+	}
+	for _, name := range names {
+		CM := maps[name]
+		if err := w.WriteLG(name, CM.Filter(), CM.Placements(nil)); err != nil {
+			fatal(exitProcessing, "-out: ", err)
+		}
+	}
+	if err := w.Finish(); err != nil {
+		fatal(exitProcessing, "-out: ", err)
+	}
+}
+
+// Write each LG of a placement result in its own file
+func Split(args []string) {
+	fs := newFlagSet("split", "-in <file> [-dir <directory>]", "Write each LG of a placement result in its own file in -dir, named after the last element of the LG name.")
+	in := fs.String("in", "", "Name of the placement result file")
+	dir := fs.String("dir", ".", "Directory for the output files")
+	ParseFlags(fs, args)
+	checkDir("dir", *dir)
+	maps, names := readResult("in", *in)
+	// The LG names come from the input, so only their last element is used to keep the files in -dir
+	files := make(map[string]string)
+	for _, name := range names {
+		file := filepath.Join(*dir, filepath.Base(name)+".txt")
+		if other, ok := files[file]; ok {
+			fatal(exitInput, "-in: LGs ", other, " and ", name, " would both be written to ", file)
+		}
+		files[file] = name
+	}
+	for _, name := range names {
+		out := createOutputFlag("dir", filepath.Join(*dir, filepath.Base(name)+".txt"))
+		_, err := io.WriteString(out, runHeader.Comment("##"))
+		if err == nil {
+			err = maps[name].WriteMap(out)
+		}
+		if err == nil {
+			_, err = io.WriteString(out, "\n")
+		}
+		if e := out.Close(); err == nil {
+			err = e
+		}
+		if err != nil {
+			fatal(exitProcessing, "-dir: ", err)
+		}
+	}
+}
+
+// Convert annotations from contig to pseudomolecule coordinates
+func Liftover(args []string) {
+	fs := newFlagSet("liftover", "(-agp <file> | -in <file> -lengths <file>) [-bed|-gff3|-vcf <file> -out <file>] [-unlifted <file>] [-chain <file>]",
+		"Convert BED, GFF3 or VCF records from contig to pseudomolecule coordinates, and write the UCSC chain file of the conversion.\n"+
+			"The pseudomolecules are read from an AGP file (as written by place -agp, with the estimated gaps), or built from a\n"+
+			"placement result and the contig lengths with gaps of unknown size (as written by export -format agp).\n"+
+			"Records on reversed contigs get the opposite strand, and the alleles of VCF records are reverse complemented.")
+	agp := fs.String("agp", "", "Name of the AGP file with the pseudomolecules")
+	in := fs.String("in", "", "Name of the placement result file, instead of -agp")
+	lengths := fs.String("lengths", "", "Name of the file with the contig lengths (fasta index or name<TAB>length), needed with -in")
+	bed := fs.String("bed", "", "Name of the BED file to convert")
+	gff := fs.String("gff3", "", "Name of the GFF3 file to convert")
+	vcf := fs.String("vcf", "", "Name of the VCF file to convert")
+	outfile := fs.String("out", "", "Name of the output file with the converted records (default stdout)")
+	unliftedFile := fs.String("unlifted", "", "Name of the output file with the records that could not be converted, each after a line with the reason")
+	chain := fs.String("chain", "", "Name of the output chain file from the contigs to the pseudomolecules")
+	quiet, logName := addLogFlags(fs)
+	ParseFlags(fs, args)
+	inputs := 0
+	for _, f := range []string{*bed, *gff, *vcf} {
+		if f != "" {
+			inputs++
+		}
+	}
+	switch {
+	case (*agp == "") == (*in == ""):
+		fatal(exitUsage, "give the pseudomolecules with either -agp or -in")
+	case *in != "" && *lengths == "":
+		fatal(exitUsage, "-in needs the contig lengths (-lengths)")
+	case inputs > 1:
+		fatal(exitUsage, "-bed, -gff3 and -vcf cannot be used together")
+	case inputs == 0 && *chain == "":
+		fatal(exitUsage, "nothing to do: give a file to convert (-bed, -gff3 or -vcf) or -chain")
+	}
+	for _, f := range [][2]string{{"agp", *agp}, {"lengths", *lengths}, {"bed", *bed}, {"gff3", *gff}, {"vcf", *vcf}} {
+		checkInput(f[0], f[1], false)
+	}
+	for _, f := range [][2]string{{"unlifted", *unliftedFile}, {"chain", *chain}, {"log", *logName}} {
+		checkOutput(f[0], f[1], false)
+	}
+	startLogging(*quiet, false, *logName)
+	defer stopLogging(*logName)
+	var lift *ContigMapping.Liftover
+	if *agp != "" {
+		readInput("agp", *agp, func(r io.Reader) (err error) {
+			lift, err = ContigMapping.ReadLiftoverAGP(r)
+			return err
+		})
+	} else {
+		maps, names := readResult("in", *in)
+		var l map[string]uint64
+		readInput("lengths", *lengths, func(r io.Reader) (err error) {
+			l, err = ContigMapping.ReadLengths(r)
+			return err
+		})
+		var placements []ContigMapping.Placement
+		for _, name := range names {
+			for _, c := range *maps[name].Contigs {
+				c.Length = l[c.Name]
+			}
+			maps[name].Filter()
+			placements = append(placements, maps[name].Placements(nil)...)
+		}
+		var err error
+		if lift, err = ContigMapping.NewLiftover(placements); err != nil {
+			fatal(exitInput, "-in: ", err)
+		}
+	}
+	if *chain != "" {
+		out := createOutputFlag("chain", *chain)
+		err := lift.WriteChain(out, runHeader)
+		if e := out.Close(); err == nil {
+			err = e
+		}
+		if err != nil {
+			fatal(exitProcessing, "-chain: ", err)
+		}
+	}
+	if inputs == 0 {
+		return
+	}
+	var unlifted io.WriteCloser
+	if *unliftedFile != "" {
+		unlifted = createOutputFlag("unlifted", *unliftedFile)
+	}
+	out := createOutput("out", *outfile)
+	flagName, file, run := "bed", *bed, lift.LiftBED
+	switch {
+	case *gff != "":
+		flagName, file, run = "gff3", *gff, lift.LiftGFF
+	case *vcf != "":
+		flagName, file, run = "vcf", *vcf, lift.LiftVCF
+	}
+	var counts ContigMapping.LiftCounts
+	readInput(flagName, file, func(r io.Reader) (err error) {
+		if unlifted == nil {
+			counts, err = run(r, out, nil, runHeader)
+		} else {
+			counts, err = run(r, out, unlifted, runHeader)
+		}
+		return err
+	})
+	err := out.Close()
+	if unlifted != nil {
+		if e := unlifted.Close(); err == nil {
+			err = e
+		}
+	}
+	if err != nil {
+		fatal(exitProcessing, "-out: ", err)
+	}
+	summary := fmt.Sprintf("Converted %d records, %d could not be converted", counts.Lifted, counts.Unlifted)
+	fmt.Fprintln(diagLog, summary)
+	progress(summary)
+}
+
+// Simulate a genome, a genetic map and the markers on the contigs, and write them with the true placement
+func Simulate(args []string) {
+	fs := newFlagSet("simulate", "-out <prefix> [flags]",
+		"Simulate a genome of contigs and a genetic map. Writes <prefix>.map and <prefix>_markers.txt, the inputs of place,\n"+
+			"and <prefix>_truth.tsv with the true LG, position and orientation of every contig.")
+	p := ContigMapping.DefaultSimParams()
+	prefix := fs.String("out", "", "Prefix of the output files")
+	seed := fs.Int64("seed", 1, "Seed of the random number generator")
+	fs.IntVar(&p.Chromosomes, "chromosomes", p.Chromosomes, "Number of chromosomes, each one a LG")
+	fs.Uint64Var(&p.ChromosomeLength, "chrlength", p.ChromosomeLength, "Length of each chromosome (bp)")
+	fs.Uint64Var(&p.ContigLength, "contiglength", p.ContigLength, "Mean length of the contigs (bp)")
+	fs.Float64Var(&p.MapLength, "maplength", p.MapLength, "Length of the genetic map of each chromosome (cM)")
+	fs.StringVar(&p.Landscape, "landscape", p.Landscape, "Recombination landscape: uniform or telomeric (no recombination in the centre)")
+	fs.Float64Var(&p.MarkerDensity, "density", p.MarkerDensity, "Markers per Mb")
+	fs.IntVar(&p.Individuals, "individuals", p.Individuals, "Number of individuals genotyped. The weight of a marker is the number without missing data")
+	fs.Float64Var(&p.MissingRate, "missing", p.MissingRate, "Mean fraction of missing data per marker")
+	fs.Float64Var(&p.ErrorRate, "errors", p.ErrorRate, "Fraction of markers with genotyping errors, placed at a random position of their LG")
+	fs.Float64Var(&p.ChimeraRate, "chimeras", p.ChimeraRate, "Fraction of contigs joined to a contig of another chromosome")
+	fs.Float64Var(&p.MultiMapRate, "multimap", p.MultiMapRate, "Fraction of markers that also hit a random contig")
+	ParseFlags(fs, args)
+	if *prefix == "" {
+		fatal(exitUsage, "missing required flag -out")
+	}
+	if err := p.Check(); err != nil {
+		fatal(exitUsage, err)
+	}
+	for _, name := range []string{*prefix + ".map", *prefix + "_markers.txt", *prefix + "_truth.tsv"} {
+		checkOutput("out", name, true)
+	}
+	sim, err := ContigMapping.Simulate(p, rand.New(rand.NewSource(*seed)))
+	if err != nil {
+		fatal(exitProcessing, err)
+	}
+	write := func(name string, hdr string, w func(io.Writer) error) {
+		out := createOutputFlag("out", name)
+		_, err := io.WriteString(out, hdr)
+		if err == nil {
+			err = w(out)
+		}
+		if e := out.Close(); err == nil {
+			err = e
+		}
+		if err != nil {
+			fatal(exitProcessing, "-out "+name+": ", err)
+		}
+	}
+	write(*prefix+".map", "", sim.WriteMap)
+	write(*prefix+"_markers.txt", "", sim.WriteMarkers)
+	write(*prefix+"_truth.tsv", runHeader.Comment("##"), sim.WriteTruth)
+}
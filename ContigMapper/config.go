@@ -0,0 +1,147 @@
+package main
+
+import (
+	"ContigMapping"
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Version of the tool, written in the header of the outputs
+const Version = "1.1.0"
+
+// Read a configuration file with the values of the flags of a command. The keys are the flag names.
+// JSON (.json) and flat YAML (.yaml, .yml) files are recognised by the extension; anything else is read as flat TOML (key = value).
+// TOML section headers are allowed to group the keys but are ignored
+func ReadConfig(name string) (map[string]string, error) {
+	out := make(map[string]string)
+	f, err := os.Open(name)
+	if err != nil {
+		return out, err
+	}
+	defer f.Close()
+	ext := strings.ToLower(filepath.Ext(name))
+	if ext == ".json" {
+		var values map[string]interface{}
+		// Numbers are kept as written, as float64 would print large integers in exponent form
+		dec := json.NewDecoder(f)
+		dec.UseNumber()
+		if err := dec.Decode(&values); err != nil {
+			return out, fmt.Errorf("%s: %v", name, err)
+		}
+		for k, v := range values {
+			out[k] = fmt.Sprint(v)
+		}
+		return out, nil
+	}
+	sep := "="
+	if ext == ".yaml" || ext == ".yml" {
+		sep = ":"
+	}
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		switch {
+		case text == "" || strings.HasPrefix(text, "#") || text == "---":
+			continue
+		case sep == "=" && strings.HasPrefix(text, "["):
+			continue
+		}
+		kv := strings.SplitN(text, sep, 2)
+		if len(kv) != 2 {
+			return out, fmt.Errorf("%s:%d: expected key %s value", name, line, sep)
+		}
+		v := stripComment(kv[1], sep == ":")
+		if u, err := strconv.Unquote(v); err == nil {
+			v = u
+		} else if len(v) > 1 && v[0] == '\'' && v[len(v)-1] == '\'' {
+			v = v[1 : len(v)-1]
+		}
+		out[strings.TrimSpace(kv[0])] = v
+	}
+	return out, scanner.Err()
+}
+
+// Remove the trailing comment of a value and the spaces around it. A # starts a comment outside quotes, and in YAML only
+// at the start or after a space, so that a#b is a value
+func stripComment(v string, yaml bool) string {
+	var quote byte
+	for i := 0; i < len(v); i++ {
+		switch c := v[i]; {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (!yaml || i == 0 || v[i-1] == ' ' || v[i-1] == '\t'):
+			return strings.TrimSpace(v[:i])
+		}
+	}
+	return strings.TrimSpace(v)
+}
+
+// Version and configuration of the run, written at the beginning of the outputs
+var runHeader *ContigMapping.RunHeader
+
+// Parse the flags of a command, then set the ones not given in the command line from the configuration file (-config), if any.
+// The header of the outputs is built with the effective values
+func ParseFlags(fs *flag.FlagSet, args []string) {
+	fs.Parse(args)
+	if config := fs.Lookup("config").Value.String(); config != "" {
+		if err := ApplyConfig(fs, config); err != nil {
+			fatal(exitUsage, "-config: ", err)
+		}
+	}
+	runHeader = RunHeader(fs)
+}
+
+// Set the flags not given in the command line with the values of the configuration file
+func ApplyConfig(fs *flag.FlagSet, name string) error {
+	values, err := ReadConfig(name)
+	if err != nil {
+		return err
+	}
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	var keys []string
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if fs.Lookup(k) == nil || k == "config" {
+			return fmt.Errorf("%s: unknown option %q", name, k)
+		}
+		if set[k] {
+			continue
+		}
+		if err := fs.Set(k, values[k]); err != nil {
+			return fmt.Errorf("%s: option %s: %v", name, k, err)
+		}
+	}
+	return nil
+}
+
+// Header with the tool version and the effective value of every flag, to be written at the beginning of the outputs
+func RunHeader(fs *flag.FlagSet) *ContigMapping.RunHeader {
+	h := &ContigMapping.RunHeader{Version: Version, Command: fs.Name(), Config: make(map[string]string)}
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name != "config" {
+			h.Config[f.Name] = f.Value.String()
+		}
+	})
+	return h
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestApplyConfig(t *testing.T) {
+	dir := t.TempDir()
+	configs := map[string]string{
+		"run.json": `{"refminq": 1000000, "outliertol": 2.5, "quiet": true, "out": "a.txt"}`,
+		"run.toml": "[place]\nrefminq = 1000000\noutliertol = 2.5\nquiet = true\nout = \"a.txt\"\n",
+		"run.yaml": "---\nrefminq: 1000000\noutliertol: 2.5\nquiet: true\nout: 'a.txt'\n",
+	}
+	for name, config := range configs {
+		file := filepath.Join(dir, name)
+		if err := os.WriteFile(file, []byte(config), 0644); err != nil {
+			t.Fatal(err)
+		}
+		fs := flag.NewFlagSet("place", flag.ContinueOnError)
+		refminq := fs.Uint64("refminq", 0, "")
+		tol := fs.Float64("outliertol", 5, "")
+		quiet := fs.Bool("quiet", false, "")
+		out := fs.String("out", "", "")
+		fs.Parse([]string{"-out", "b.txt"})
+		if err := ApplyConfig(fs, file); err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		// The command line wins over the file
+		if *refminq != 1000000 || *tol != 2.5 || !*quiet || *out != "b.txt" {
+			t.Errorf("%s: refminq %d, outliertol %v, quiet %v, out %q", name, *refminq, *tol, *quiet, *out)
+		}
+	}
+	file := filepath.Join(dir, "unknown.json")
+	os.WriteFile(file, []byte(`{"nothing": 1}`), 0644)
+	if err := ApplyConfig(flag.NewFlagSet("place", flag.ContinueOnError), file); err == nil {
+		t.Error("no error for an unknown option")
+	}
+}
+
+func TestReadConfig(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name, config string
+		want         map[string]string
+	}{
+		{"comments.toml", "precision = 4  # decimals\nout = \"a#b.map\" # quoted\n[place] # section\nlog = 'x # y'\n",
+			map[string]string{"precision": "4", "out": "a#b.map", "log": "x # y"}},
+		{"comments.yaml", "out: x.map # comment\nlog: a#b\nmarey: \"c # d\"  # quoted\nprecision: 4#x\n",
+			map[string]string{"out": "x.map", "log": "a#b", "marey": "c # d", "precision": "4#x"}},
+		{"escaped.toml", "out = \"a\\\"#b\" # comment\n", map[string]string{"out": "a\"#b"}},
+	}
+	for _, tt := range tests {
+		file := filepath.Join(dir, tt.name)
+		if err := os.WriteFile(file, []byte(tt.config), 0644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ReadConfig(file)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: read %q, want %q", tt.name, got, tt.want)
+		}
+		for k, v := range tt.want {
+			if got[k] != v {
+				t.Errorf("%s: %s = %q, want %q", tt.name, k, got[k], v)
+			}
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"ContigMapping"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Exit codes of the tool
+const (
+	exitUsage      = 2 // Wrong or missing flags
+	exitInput      = 3 // Missing, unreadable or malformed inputs, and outputs that cannot be created
+	exitProcessing = 4 // Errors while placing the contigs or writing the results
+)
+
+// Verbosity of the progress messages written to stderr: 0 quiet, 1 normal, 2 verbose
+var verbosity = 1
+
+// Destination of the per-contig diagnostics: the -log file, stderr in verbose mode or nowhere
+var diagLog io.Writer = io.Discard
+
+// Print a progress message to stderr unless in quiet mode
+func progress(a ...interface{}) {
+	if verbosity > 0 {
+		fmt.Fprintln(os.Stderr, a...)
+	}
+}
+
+// Add -quiet and -log to a command that reports its progress. They are applied with startLogging after parsing the flags
+func addLogFlags(fs *flag.FlagSet) (quiet *bool, log *string) {
+	quiet = fs.Bool("quiet", false, "Do not write progress messages to stderr")
+	log = fs.String("log", "", "Name of the file for the diagnostics of the run")
+	return quiet, log
+}
+
+// Set the verbosity and open the -log file, starting with the header of the run. Without -log the diagnostics are
+// written to stderr only in verbose mode
+func startLogging(quiet, verbose bool, logName string) {
+	switch {
+	case quiet:
+		verbosity = 0
+	case verbose:
+		verbosity = 2
+	}
+	switch {
+	case logName != "":
+		diagLog = createOutputFlag("log", logName)
+		fmt.Fprint(diagLog, runHeader.Comment("##"))
+	case verbosity > 1:
+		diagLog = os.Stderr
+	}
+}
+
+// Close the -log file opened by startLogging, if any
+func stopLogging(logName string) {
+	if logName != "" {
+		closeOutput("log", diagLog.(io.Closer))
+	}
+}
+
+// Print the error and exit with the given code
+func fatal(code int, a ...interface{}) {
+	fmt.Fprintln(os.Stderr, "ContigMapper: "+fmt.Sprint(a...))
+	os.Exit(code)
+}
+
+// Check that the input given in a flag exists and can be read. "-" is stdin.
+// An empty name is a usage error if the input is required and is accepted otherwise
+func checkInput(flagName, name string, required bool) {
+	switch {
+	case name == "" && required:
+		fatal(exitUsage, "missing required flag -"+flagName)
+	case name == "" || name == "-":
+		return
+	}
+	info, err := os.Stat(name)
+	switch {
+	case err != nil:
+		fatal(exitInput, "-"+flagName+": ", err)
+	case info.IsDir():
+		fatal(exitInput, "-"+flagName+": "+name+" is a directory")
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		fatal(exitInput, "-"+flagName+": ", err)
+	}
+	magic := make([]byte, 4)
+	n, _ := io.ReadFull(f, magic)
+	f.Close()
+	if err := ContigMapping.CheckDecompressor(magic[:n]); err != nil {
+		fatal(exitInput, "-"+flagName+" "+name+": ", err)
+	}
+}
+
+// Check that the output given in a flag can be created: its directory must exist and be writable. "-" is stdout.
+// An empty name is a usage error if the output is required and is accepted otherwise
+func checkOutput(flagName, name string, required bool) {
+	switch {
+	case name == "" && required:
+		fatal(exitUsage, "missing required flag -"+flagName)
+	case name == "" || name == "-":
+		return
+	}
+	if info, err := os.Stat(name); err == nil && info.IsDir() {
+		fatal(exitInput, "-"+flagName+": "+name+" is a directory")
+	}
+	checkDir(flagName, filepath.Dir(name))
+}
+
+// Check that the directory exists and that files can be created in it
+func checkDir(flagName, dir string) {
+	info, err := os.Stat(dir)
+	switch {
+	case err != nil:
+		fatal(exitInput, "-"+flagName+": output directory: ", err)
+	case !info.IsDir():
+		fatal(exitInput, "-"+flagName+": "+dir+" is not a directory")
+	}
+	f, err := os.CreateTemp(dir, ".ContigMapper")
+	if err != nil {
+		fatal(exitInput, "-"+flagName+": output directory "+dir+" is not writable")
+	}
+	f.Close()
+	os.Remove(f.Name())
+}
+
+// Open the input given in a flag and read it with read. Errors exit naming the flag, including those of closing the
+// input, where the errors of the decompression end up
+func readInput(flagName, name string, read func(r io.Reader) error) {
+	f, err := ContigMapping.Open(name)
+	if err != nil {
+		fatal(exitInput, "-"+flagName+": ", err)
+	}
+	err = read(f)
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		fatal(exitInput, "-"+flagName+" "+name+": ", err)
+	}
+}
+
+// Create the output given in a flag. Errors exit naming the flag
+func createOutputFlag(flagName, name string) io.WriteCloser {
+	out, err := ContigMapping.Create(name)
+	if err != nil {
+		fatal(exitInput, "-"+flagName+": ", err)
+	}
+	return out
+}
+
+// Close the output given in a flag, where the last writes and the compression are finished. Errors exit naming the flag
+func closeOutput(flagName string, out io.Closer) {
+	if err := out.Close(); err != nil {
+		fatal(exitProcessing, "-"+flagName+": ", err)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Read a test input, or the lines from..to of it if to > 0
+func testInput(f *testing.F, name string, from, to int) string {
+	data, err := os.ReadFile(filepath.Join("..", "ContigMapper_testfiles", name))
+	if err != nil {
+		f.Fatal(err)
+	}
+	if to == 0 {
+		return string(data)
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	if to > len(lines) {
+		to = len(lines)
+	}
+	return strings.Join(lines[from:to], "")
+}
+
+// Load the inputs and write the maps. Errors in the inputs are expected, panics are not
+func fuzzLoad(t *testing.T, genMap, markers string) {
+	verbosity = 0
+	lgMap, _, err := load(strings.NewReader(genMap), strings.NewReader(markers), io.Discard)
+	if err != nil {
+		return
+	}
+	if err := WriteContigMaps(mapWriter(io.Discard), lgMap, false); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func FuzzGenMap(f *testing.F) {
+	markers := testInput(f, "test1_marker.txt", 0, 0)
+	f.Add(testInput(f, "test1.map", 0, 0))
+	f.Add(testInput(f, "test2.map", 0, 60))
+	f.Add(testInput(f, "test2.map", 5000, 5060))
+	f.Add(testInput(f, "test3.map", 0, 60))
+	f.Add(testInput(f, "test3.map", 3000, 3060))
+	f.Fuzz(func(t *testing.T, genMap string) {
+		fuzzLoad(t, genMap, markers)
+	})
+}
+
+func FuzzMarkerInfo(f *testing.F) {
+	genMap := testInput(f, "test1.map", 0, 0)
+	f.Add(testInput(f, "test1_marker.txt", 0, 0))
+	f.Add(testInput(f, "test2_marker.txt", 0, 60))
+	f.Add(testInput(f, "test2_marker.txt", 10000, 10060))
+	f.Add(testInput(f, "test3_marker.txt", 0, 60))
+	f.Add(testInput(f, "test3_marker.txt", 5000, 5060))
+	f.Fuzz(func(t *testing.T, markers string) {
+		fuzzLoad(t, genMap, markers)
+	})
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"ContigMapping"
+	"bytes"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "Regenerate the golden files in testdata")
+
+// Writer of the result format, as written by place
+func mapWriter(w io.Writer) ContigMapping.Writer {
+	out, _ := ContigMapping.NewWriter("map", w, nil)
+	return out
+}
+
+// Compare the output with the golden file, or write it with -update
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	golden := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(golden, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s: output differs from the golden file, run go test -update if the change is intended", golden)
+	}
+}
+
+// Check that the contig counts of the LGs add up to the total. The contigs with markers and the unplaceable ones are
+// counted in every LG where they have markers and do not
+func checkTotals(t *testing.T, stats []*ContigMapping.Stats, total *ContigMapping.Stats) {
+	t.Helper()
+	var sum ContigMapping.Stats
+	for _, s := range stats {
+		sum.Assigned += s.Assigned
+		sum.Placed += s.Placed
+		sum.Oriented += s.Oriented
+		sum.Unoriented += s.Unoriented
+		sum.Removed += s.Removed
+	}
+	if sum.Assigned != total.Assigned || sum.Placed != total.Placed || sum.Oriented != total.Oriented ||
+		sum.Unoriented != total.Unoriented || sum.Removed != total.Removed {
+		t.Errorf("LGs add up to assigned %d, placed %d, oriented %d, unoriented %d, removed %d, the total has %d, %d, %d, %d, %d",
+			sum.Assigned, sum.Placed, sum.Oriented, sum.Unoriented, sum.Removed,
+			total.Assigned, total.Placed, total.Oriented, total.Unoriented, total.Removed)
+	}
+}
+
+// Run the placement on the shipped test inputs and compare the maps and statistics with the golden files
+func TestGolden(t *testing.T) {
+	verbosity = 0
+	for i := 1; i <= 3; i++ {
+		test := "test" + strconv.Itoa(i)
+		t.Run(test, func(t *testing.T) {
+			mapHandle, err := ContigMapping.Open(filepath.Join("..", "ContigMapper_testfiles", test+".map"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			markerHandle, err := ContigMapping.Open(filepath.Join("..", "ContigMapper_testfiles", test+"_marker.txt"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			lgMap, cMap := Load(mapHandle, markerHandle, &bytes.Buffer{})
+			// The header of the run is skipped when the model is read back
+			h := &ContigMapping.RunHeader{Version: Version, Command: "place", Config: map[string]string{"map": test + ".map"}}
+			var model bytes.Buffer
+			if err := ContigMapping.WriteModel(&model, lgMap, sortedLGs(lgMap), i == 2, h); err != nil {
+				t.Fatal(err)
+			}
+			var snapshot bytes.Buffer
+			if err := ContigMapping.WriteSnapshot(&snapshot, lgMap, sortedLGs(lgMap), cMap, h); err != nil {
+				t.Fatal(err)
+			}
+			var out bytes.Buffer
+			if err := WriteContigMaps(mapWriter(&out), lgMap, false); err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, test+".out", out.Bytes())
+			// The model reloaded and filtered again gives the same maps, in JSON and in JSON Lines
+			reloaded, _, err := ContigMapping.ReadModel(&model)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out.Reset()
+			if err := WriteContigMaps(mapWriter(&out), reloaded, false); err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, test+".out", out.Bytes())
+			out.Reset()
+			stats, total := ContigMapping.Summarise(lgMap, cMap)
+			checkTotals(t, stats, total)
+			if err := ContigMapping.WriteStats(&out, stats, total); err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, test+".stats", out.Bytes())
+			// The snapshot reloaded gives the same maps and statistics
+			lgMap, _, cMap, err = ContigMapping.ReadSnapshot(&snapshot)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out.Reset()
+			if err := WriteContigMaps(mapWriter(&out), lgMap, false); err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, test+".out", out.Bytes())
+			out.Reset()
+			stats, total = ContigMapping.Summarise(lgMap, cMap)
+			if err := ContigMapping.WriteStats(&out, stats, total); err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, test+".stats", out.Bytes())
+		})
+	}
+}
@@ -7,179 +7,448 @@ import (
 	"bufio"
 	"flag"
 	"fmt"
-	"log"
+	"io"
+	"math"
 	"os"
-	"regexp"
-	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 )
 
-func ReadCmdLine() (*os.File, *os.File, string, int) {
+// Register the flags of the place command, parse them and open the input files
+func ReadCmdLine(fs *flag.FlagSet, args []string) (io.ReadCloser, io.ReadCloser, string, int) {
 	var mapFile, markerFile, outfile string
 	var t int
-	flag.StringVar(&mapFile, "map", "", "Name of the file with the genetic map")
-	flag.StringVar(&markerFile, "markers", "", "Name of the file with the marker information")
-	flag.StringVar(&outfile, "out", "", "Name of the output file")
-	flag.IntVar(&t, "threads", 1, "Number of threads/cores to use")
-	flag.Parse()
-	mapHandle, maperr := os.Open(mapFile)
-	markerHandle, markererr := os.Open(markerFile)
-	if maperr != nil || markererr != nil {
-		log.Fatal(maperr, markererr)
+	fs.StringVar(&mapFile, "map", "", "Name of the file with the genetic map (- for stdin). gzip, bgzip and zstd (needs the zstd program) compressed files are accepted")
+	fs.StringVar(&markerFile, "markers", "", "Name of the file with the marker information (- for stdin). gzip, bgzip and zstd (needs the zstd program) compressed files are accepted")
+	fs.StringVar(&outfile, "out", "", "Name of the output file (- for stdout). Names ending in .gz are gzip compressed")
+	fs.StringVar(&outFormat, "format", "map", "Format of -out: "+strings.Join(ContigMapping.Formats, ", ")+". agp and bed need -lengths or -fasta")
+	fs.IntVar(&t, "threads", 1, "Number of threads/cores to use")
+	fs.IntVar(&ContigMapping.Precision, "precision", 3, "Number of decimals kept for the genetic positions (cM)")
+	fs.StringVar(&lengthsFile, "lengths", "", "Name of the file with the contig lengths (fasta index or name<TAB>length)")
+	fs.StringVar(&fastaFile, "fasta", "", "Name of the fasta file with the contig sequences. The index <file>.fai is used if present. gzip, bgzip and zstd (needs the zstd program) compressed files and stdin are accepted and decompressed to a temporary file")
+	fs.StringVar(&agpFile, "agp", "", "Name of the AGP output file with the pseudomolecules. Needs -lengths or -fasta")
+	fs.StringVar(&pseudoFile, "pseudo", "", "Name of the fasta output file with the pseudomolecules. Needs -fasta")
+	fs.StringVar(&fromFile, "from", "", "Name of a snapshot (-snapshot) to start from instead of -map and -markers: only filtering, ordering and the outputs are run")
+	fs.StringVar(&overridesFile, "overrides", "", "Name of the file with the curation overrides, one per line: contig<TAB>action[<TAB>value] (see the help)")
+	fs.StringVar(&snapshotFile, "snapshot", "", "Name of the output file with the snapshot of the run after the contigs are completed, to be used with -from")
+	fs.StringVar(&modelFile, "model", "", "Name of the output file with the full model of the LGs in JSON: the contigs with their markers and computed fields, before filtering")
+	fs.StringVar(&modelFormat, "modelformat", "json", "Format of -model: json, or jsonl for one LG per line")
+	fs.StringVar(&bedFile, "bed", "", "Name of the BED output file with the contigs on the pseudomolecules. Needs -lengths or -fasta")
+	fs.StringVar(&markerBedFile, "markerbed", "", "Name of the BED output file with the markers on the pseudomolecules, named marker:cM. Needs -lengths or -fasta")
+	fs.StringVar(&gffFile, "gff3", "", "Name of the GFF3 output file with the contigs on the pseudomolecules and their LG, cM, weight and orientation. Needs -lengths or -fasta")
+	fs.Float64Var(&gapWindow, "gapwindow", 0, "Size (cM) of the sliding window used to estimate the recombination rate for the gaps. 0 uses the whole LG")
+	fs.StringVar(&refPaf, "refpaf", "", "Name of the PAF file with the alignment of the contigs to a reference genome, used to order contigs in the same bin")
+	fs.BoolVar(&refPlace, "refplace", false, "Place contigs without markers between map-anchored neighbours using the alignment to the reference (-refpaf)")
+	fs.Uint64Var(&refMinQ, "refminq", 0, "Minimum mapping quality of the alignments in -refpaf")
+	fs.StringVar(&hicLinks, "hiclinks", "", "Name of the file with Hi-C contact counts (contig1<TAB>contig2<TAB>count), used to order contigs in the same bin")
+	fs.StringVar(&barcodeFile, "barcodes", "", "Name of the file with linked-read barcodes (contig<TAB>barcode), used to order contigs in the same bin")
+	fs.StringVar(&hicPairs, "hicpairs", "", "Name of the 4DN pairs file with Hi-C contacts, used to orient and order the contigs. Contig lengths come from the #chromsize header or -lengths. Orientations against the map are written as \"## hic conflict:\" lines of the outputs")
+	fs.StringVar(&hicEnds, "hicends", "", "Name of the file with Hi-C contacts between contig ends (contig1<TAB>start|end<TAB>contig2<TAB>start|end<TAB>count). Orientations against the map are written as \"## hic conflict:\" lines of the outputs")
+	fs.StringVar(&adjFile, "adjacencies", "", "Name of the output file with the evidence for each adjacency of the final order")
+	fs.StringVar(&statsFile, "stats", "", "Name of the output file with the summary statistics per LG and overall as a table")
+	fs.StringVar(&summaryFile, "summary", "", "Name of the output file with the human readable summary per LG and overall")
+	fs.StringVar(&mareyDir, "marey", "", "Name of the directory for the Marey plots (SVG), one <LG>.svg per linkage group")
+	fs.Float64Var(&outlierTol, "outliertol", 5, "Distance (cM) outside the range of its contig beyond which a marker is highlighted as an outlier in the Marey plots")
+	fs.StringVar(&ideogramFile, "ideogram", "", "Name of the SVG output file with the ideogram of all the linkage groups and their placed contigs")
+	fs.StringVar(&cpuProfile, "cpuprofile", "", "Name of the file for a CPU profile of the run (go tool pprof)")
+	fs.StringVar(&memProfile, "memprofile", "", "Name of the file for a memory profile taken at the end of the run (go tool pprof)")
+	fs.StringVar(&logFile, "log", "", "Name of the file for the per-contig diagnostics. Without it they are written to stderr only with -v")
+	quiet := fs.Bool("quiet", false, "Do not write progress messages to stderr")
+	verbose := fs.Bool("v", false, "Write the per-contig diagnostics to stderr when there is no -log")
+	ParseFlags(fs, args)
+	if fs.NArg() > 0 {
+		fatal(exitUsage, "unexpected arguments: ", fs.Args())
+	}
+
+	if fromFile != "" && (mapFile != "" || markerFile != "") {
+		fatal(exitUsage, "-from cannot be used with -map and -markers")
+	}
+	// Check everything before doing any work, so that a wrong path does not waste a long run
+	checkInput("map", mapFile, fromFile == "")
+	checkInput("markers", markerFile, fromFile == "")
+	checkInput("from", fromFile, false)
+	checkInput("overrides", overridesFile, false)
+	checkOutput("out", outfile, true)
+	for _, f := range [][2]string{{"lengths", lengthsFile}, {"fasta", fastaFile}, {"refpaf", refPaf}, {"hiclinks", hicLinks},
+		{"barcodes", barcodeFile}, {"hicpairs", hicPairs}, {"hicends", hicEnds}} {
+		checkInput(f[0], f[1], false)
+	}
+	for _, f := range [][2]string{{"agp", agpFile}, {"pseudo", pseudoFile}, {"snapshot", snapshotFile}, {"model", modelFile}, {"bed", bedFile}, {"markerbed", markerBedFile}, {"gff3", gffFile}, {"adjacencies", adjFile}, {"log", logFile}, {"stats", statsFile}, {"summary", summaryFile},
+		{"ideogram", ideogramFile}, {"cpuprofile", cpuProfile}, {"memprofile", memProfile}} {
+		checkOutput(f[0], f[1], false)
+	}
+	if mareyDir != "" {
+		checkDir("marey", mareyDir)
+	}
+	switch {
+	case mapFile == "-" && markerFile == "-":
+		fatal(exitUsage, "-map and -markers cannot both be read from stdin")
+	case t < 1:
+		fatal(exitUsage, "-threads must be at least 1")
+	case ContigMapping.Precision < 0:
+		fatal(exitUsage, "-precision cannot be negative")
+	case refPlace && refPaf == "":
+		fatal(exitUsage, "-refplace needs the alignment of the contigs to the reference (-refpaf)")
+	case pseudoFile != "" && fastaFile == "":
+		fatal(exitUsage, "-pseudo needs the contig sequences (-fasta)")
+	case !validFormat(outFormat):
+		fatal(exitUsage, "-format: unknown output format "+outFormat+", use one of "+strings.Join(ContigMapping.Formats, ", "))
+	case ContigMapping.NeedsLengths(outFormat) && fastaFile == "" && lengthsFile == "":
+		fatal(exitUsage, "-format "+outFormat+" needs the contig lengths (-lengths or -fasta)")
+	case agpFile != "" && fastaFile == "" && lengthsFile == "":
+		fatal(exitUsage, "-agp needs the contig lengths (-lengths or -fasta)")
+	case (bedFile != "" || markerBedFile != "" || gffFile != "") && fastaFile == "" && lengthsFile == "":
+		fatal(exitUsage, "-bed, -markerbed and -gff3 need the contig lengths (-lengths or -fasta)")
+	case modelFormat != "json" && modelFormat != "jsonl":
+		fatal(exitUsage, "-modelformat must be json or jsonl")
+	case hicPairs != "" && hicEnds != "":
+		fatal(exitUsage, "-hicpairs and -hicends cannot be used together")
+	case outlierTol < 0:
+		fatal(exitUsage, "-outliertol cannot be negative")
+	case *quiet && *verbose:
+		fatal(exitUsage, "-quiet and -v cannot be used together")
+	}
+	startLogging(*quiet, *verbose, logFile)
+	if fromFile != "" {
+		return nil, nil, outfile, t
+	}
+	mapHandle, err := ContigMapping.Open(mapFile)
+	if err != nil {
+		fatal(exitInput, "-map: ", err)
+	}
+	markerHandle, err := ContigMapping.Open(markerFile)
+	if err != nil {
+		fatal(exitInput, "-markers: ", err)
 	}
 	return mapHandle, markerHandle, outfile, t
 }
 
-func parseGenMap(MChan chan map[string]*ContigMapping.Marker, lgChan chan map[string]*ContigMapping.ContigMap, file *os.File) {
-	defer file.Close()
-	fmt.Println("Reading and parsing map...")
+// Kinds of lines of the genetic map
+const (
+	mapSkip   = iota // Comments, starting with ;, and blank lines
+	mapGroup         // "group <name>", starting a LG
+	mapMarker        // "marker<TAB>position(cM)"
+)
+
+// Parse a line of the genetic map. It returns its kind with the name of the group or the marker, and the position of the
+// marker rounded to the precision. place and validate both read the map with it
+func parseMapLine(text string) (kind int, name string, pos float64, err error) {
+	switch {
+	case text == "" || strings.HasPrefix(text, ";"):
+		return mapSkip, "", 0, nil
+	case strings.HasPrefix(text, "group"):
+		g := strings.Split(text, " ")
+		if len(g) < 2 || g[1] == "" {
+			return mapGroup, "", 0, fmt.Errorf("group without name")
+		}
+		return mapGroup, g[1], 0, nil
+	}
+	values := strings.Split(text, "\t")
+	if len(values) < 2 {
+		return mapMarker, "", 0, fmt.Errorf("expected marker<TAB>position")
+	}
+	p, err := strconv.ParseFloat(values[1], 64)
+	if err != nil || math.IsNaN(p) || math.IsInf(p, 0) {
+		return mapMarker, values[0], 0, fmt.Errorf("wrong position %q", values[1])
+	}
+	return mapMarker, values[0], ContigMapping.Round(p), nil
+}
+
+// Marker on a contig read from a line of the marker file
+type markerLine struct {
+	marker, contig string
+	pos            float64
+	weight         uint64
+}
+
+// Parse a line of the marker file. Blank lines give a markerLine without marker. place and validate both read the
+// markers with it
+func parseMarkerLine(text string) (markerLine, error) {
+	if text == "" {
+		return markerLine{}, nil
+	}
+	values := strings.Split(text, "\t")
+	if len(values) < 4 {
+		return markerLine{}, fmt.Errorf("expected marker<TAB>contig<TAB>position<TAB>weight")
+	}
+	pos, err := strconv.ParseFloat(values[2], 64)
+	if err != nil || math.IsNaN(pos) || math.IsInf(pos, 0) || pos < 0 {
+		return markerLine{}, fmt.Errorf("wrong contig position %q", values[2])
+	}
+	weight, err := strconv.ParseUint(values[3], 10, 64)
+	if err != nil {
+		return markerLine{}, fmt.Errorf("wrong weight %q", values[3])
+	}
+	return markerLine{values[0], values[1], pos, weight}, nil
+}
+
+// Parse the genetic map. The markers are shared with parseMarkerInfo through MChan. Malformed lines stop the parsing
+// and the error is sent to errChan, always before the LGs are sent to lgChan
+func parseGenMap(MChan chan map[string]*ContigMapping.Marker, lgChan chan map[string]*ContigMapping.ContigMap, errChan chan error, file io.Reader) {
+	progress("Reading and parsing map...")
 	LGMap := make(map[string]*ContigMapping.ContigMap)
 	LG := ContigMapping.NewContigMap()
-	var skipRegex = regexp.MustCompile(`^;`)
-	var GP = regexp.MustCompile(`^group`)
 	scanner := bufio.NewScanner(file)
+	line := 0
+	var err error
 L:
 	for {
 		ok := scanner.Scan()
-		switch {
-		case !ok:
+		line++
+		if !ok {
 			LGMap[LG.Name] = LG
+			err = scanner.Err()
+			break
+		}
+		kind, name, pos, e := parseMapLine(scanner.Text())
+		switch {
+		case e != nil:
+			err = fmt.Errorf("line %d: %v", line, e)
 			break L
-		case skipRegex.MatchString(scanner.Text()) || scanner.Text() == "":
-			continue
-		case GP.MatchString(scanner.Text()):
+		case kind == mapGroup:
 			if LG.Name != "" {
 				LGMap[LG.Name] = LG
 				LG = ContigMapping.NewContigMap()
 			}
-			g := strings.Split(scanner.Text(), " ")
-			LG.Name = g[1]
-		default:
+			LG.Name = name
+		case kind == mapMarker:
 			markers := <-MChan
-			values := strings.Split(scanner.Text(), "\t")
-			p, _ := strconv.ParseFloat(values[1], 64)
-			po, _ := strconv.ParseFloat(fmt.Sprintf("%.03f", p), 64)
-			pos := uint64(po * 1000)
-			if m, ok := markers[values[0]]; ok {
+			if m, ok := markers[name]; ok {
 				m.GenPos = pos
 				m.LG = LG.Name
 				LG.AddMarkers(m)
 			} else {
-				M := &ContigMapping.Marker{Name: values[0], GenPos: pos, LG: LG.Name}
-				markers[values[0]] = M
+				M := &ContigMapping.Marker{Name: name, GenPos: pos, LG: LG.Name}
+				markers[name] = M
 				LG.AddMarkers(M)
 			}
 			MChan <- markers
 		}
 	}
+	if err != nil {
+		err = fmt.Errorf("-map: %v", err)
+	}
+	errChan <- err
 	lgChan <- LGMap
-	fmt.Println("Finished with map")
+	progress("Finished with map")
 }
 
-func parseMarkerInfo(MChan chan map[string]*ContigMapping.Marker, cChan chan map[string]*ContigMapping.Contig, file *os.File) {
-	defer file.Close()
-	fmt.Println("Reading and parsing marker info...")
+// Parse the markers on the contigs. The markers are shared with parseGenMap through MChan. Malformed lines stop the parsing
+// and the error is sent to errChan, always before the contigs are sent to cChan
+func parseMarkerInfo(MChan chan map[string]*ContigMapping.Marker, cChan chan map[string]*ContigMapping.Contig, errChan chan error, file io.Reader) {
+	progress("Reading and parsing marker info...")
 	CMap := make(map[string]*ContigMapping.Contig)
 	var mok, cok bool
 	m := &ContigMapping.Marker{}
 	c := ContigMapping.NewContig()
 	scanner := bufio.NewScanner(file)
+	line := 0
+	var err error
 	for scanner.Scan() {
-		values := strings.Split(scanner.Text(), "\t")
-		p := strings.Split(values[2], ".")
-		pos, _ := strconv.ParseUint(p[0], 10, 64)
-		weight, _ := strconv.ParseUint(values[3], 10, 64)
+		line++
+		ml, e := parseMarkerLine(scanner.Text())
+		if e != nil {
+			err = fmt.Errorf("line %d: %v", line, e)
+			break
+		}
+		if ml.marker == "" {
+			continue
+		}
 		markers := <-MChan
-		m, mok = markers[values[0]]
-		c, cok = CMap[values[1]]
+		m, mok = markers[ml.marker]
+		c, cok = CMap[ml.contig]
 		if mok {
-			m.Contig = values[1]
-			m.Weight = weight
-			m.ConPos = pos
+			m.Contig = ml.contig
+			m.Weight = ml.weight
+			m.ConPos = ml.pos
 		} else {
-			m = &ContigMapping.Marker{Name: values[0], Contig: values[1], Weight: weight, ConPos: pos}
-			markers[values[0]] = m
+			m = &ContigMapping.Marker{Name: ml.marker, Contig: ml.contig, Weight: ml.weight, ConPos: ml.pos}
+			markers[ml.marker] = m
 		}
 		if cok {
 			c.AddMarkers(m)
 		} else {
 			c = ContigMapping.NewContig()
-			c.Name = values[1]
+			c.Name = ml.contig
 			c.AddMarkers(m)
-			CMap[values[1]] = c
+			CMap[ml.contig] = c
 		}
 		MChan <- markers
 	}
+	if err == nil {
+		err = scanner.Err()
+	}
+	if err != nil {
+		err = fmt.Errorf("-markers: %v", err)
+	}
+	errChan <- err
 	cChan <- CMap
-	fmt.Println("Finished reading marker info")
+	progress("Finished reading marker info")
 }
 
-func CompleteContigs(c *ContigMapping.Contig, lgChan chan map[string]*ContigMapping.ContigMap, erChan chan *os.File, wg *sync.WaitGroup) {
+func CompleteContigs(c *ContigMapping.Contig, lgChan chan map[string]*ContigMapping.ContigMap, erChan chan io.Writer, wg *sync.WaitGroup) {
 	er := c.Autocomplete()
 	erOut := <-erChan
 	fmt.Fprintln(erOut, er)
 	erChan <- erOut
 	lgMap := <-lgChan
-	if LG, ok := lgMap[c.LG]; ok && c.Placeable {
+	LG, ok := lgMap[c.LG]
+	switch {
+	case ok && c.Placeable:
 		LG.AddContigs(c)
+	case c.Placeable && c.LG == "":
+		c.Placeable = false
+		c.Reason = ContigMapping.ReasonNoMapPosition
+	case c.Placeable:
+		c.Placeable = false
+		c.Reason = ContigMapping.ReasonUnknownLG
 	}
 	lgChan <- lgMap
 	wg.Done()
 }
 
-func WriteContigMaps(LG *ContigMapping.ContigMap, erChan chan *os.File, wg *sync.WaitGroup) {
-	records := LG.WriteMap()
-	o := <-erChan
-	fmt.Fprintln(o, records)
-	erChan <- o
-	wg.Done()
+// Write the maps of all the LGs, sorted by name so that the output is always the same. The LGs are filtered concurrently
+// and then streamed to out one after the other. With gaps the pseudomolecule positions use the gaps estimated with -gapwindow
+func WriteContigMaps(out ContigMapping.Writer, lgMap map[string]*ContigMapping.ContigMap, gaps bool) error {
+	var wg sync.WaitGroup
+	names := sortedLGs(lgMap)
+	for _, name := range names {
+		wg.Add(1)
+		go func(LG *ContigMapping.ContigMap) {
+			LG.Filter()
+			wg.Done()
+		}(lgMap[name])
+	}
+	wg.Wait()
+	for _, name := range names {
+		LG := lgMap[name]
+		var g []ContigMapping.Gap
+		if gaps {
+			g = LG.EstimateGaps(gapWindow)
+		}
+		if err := out.WriteLG(name, LG.Deleted, LG.Placements(g)); err != nil {
+			return err
+		}
+	}
+	return out.Finish()
+}
 
+// Parse the map and the marker files, close them and complete the contigs. The log of each contig is written to erOut.
+// It returns the ContigMaps by LG name and all the contigs by name. Malformed inputs exit with exitInput
+func Load(mapHandle, markerHandle io.ReadCloser, erOut io.Writer) (map[string]*ContigMapping.ContigMap, map[string]*ContigMapping.Contig) {
+	lgMap, cMap, err := load(mapHandle, markerHandle, erOut)
+	if err != nil {
+		fatal(exitInput, err)
+	}
+	// Decompression errors are found when closing
+	if err := mapHandle.Close(); err != nil {
+		fatal(exitInput, "-map: ", err)
+	}
+	if err := markerHandle.Close(); err != nil {
+		fatal(exitInput, "-markers: ", err)
+	}
+	return lgMap, cMap
 }
 
-func main() {
+// Parse the map and the marker files and complete the contigs, returning the first error found in the inputs
+func load(mapHandle, markerHandle io.Reader, erOut io.Writer) (map[string]*ContigMapping.ContigMap, map[string]*ContigMapping.Contig, error) {
 	var wg sync.WaitGroup
 	MMap := make(map[string]*ContigMapping.Marker)
 	mChan := make(chan map[string]*ContigMapping.Marker, 1)
 	lgChan := make(chan map[string]*ContigMapping.ContigMap, 1)
 	cChan := make(chan map[string]*ContigMapping.Contig, 1)
-	erChan := make(chan *os.File, 1)
-	mapHandle, markerHandle, outfile, t := ReadCmdLine()
-	runtime.GOMAXPROCS(t)
+	erChan := make(chan io.Writer, 1)
+	errChan := make(chan error, 2)
 	mChan <- MMap
-	go parseGenMap(mChan, lgChan, mapHandle)
-	go parseMarkerInfo(mChan, cChan, markerHandle)
+	go parseGenMap(mChan, lgChan, errChan, mapHandle)
+	go parseMarkerInfo(mChan, cChan, errChan, markerHandle)
 	cMap := <-cChan
 	lgMap := <-lgChan
-	MMap = <-mChan
+	<-mChan
+	for i := 0; i < 2; i++ {
+		if err := <-errChan; err != nil {
+			return nil, nil, err
+		}
+	}
 	lgChan <- lgMap
-	erChan <- os.Stderr
-	fmt.Println("Completing contigs...")
+	erChan <- erOut
+	progress("Completing contigs...")
 	for _, c := range cMap {
 		wg.Add(1)
 		go CompleteContigs(c, lgChan, erChan, &wg)
 	}
 	wg.Wait()
 	lgMap = <-lgChan
-	fmt.Println("Done")
-	fmt.Println("Writing the maps...")
-	out, e := os.Create(outfile)
-	if e != nil {
-		panic(e)
+	progress("Done")
+	return lgMap, cMap, nil
+}
+
+// Check if the format is one of the output formats of the writers
+func validFormat(format string) bool {
+	for _, f := range ContigMapping.Formats {
+		if f == format {
+			return true
+		}
 	}
+	return false
+}
 
-	// Clean the channel from os.Stderr writer
-	<-erChan
+// Sorted names of the LGs, so that the outputs do not depend on the iteration order of the map
+func sortedLGs(lgMap map[string]*ContigMapping.ContigMap) (out []string) {
+	for name := range lgMap {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
 
-	// Load the channel with the output file
-	erChan <- out
-	for _, LG := range lgMap {
-		wg.Add(1)
-		go WriteContigMaps(LG, erChan, &wg)
+// Subcommands of the tool. Each one parses its own flags from args
+type command struct {
+	name  string
+	usage string
+	run   func(args []string)
+}
+
+var commands = []command{
+	{"place", "Place the contigs in the genetic map and write the ordered contigs of each LG (default)", Place},
+	{"validate", "Check the map and marker files and report the problems found", Validate},
+	{"stats", "Summarise a placement result per LG", Stats},
+	{"compare", "Report the differences between two placement results", Compare},
+	{"evaluate", "Evaluate a placement result against a reference assembly", Evaluate},
+	{"export", "Convert a placement result to other formats", Export},
+	{"split", "Write each LG of a placement result in its own file", Split},
+	{"liftover", "Convert BED, GFF3 or VCF records from contig to pseudomolecule coordinates", Liftover},
+	{"simulate", "Simulate a genome, a genetic map and markers with the true placement", Simulate},
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: ContigMapper <command> [flags]")
+	fmt.Fprintln(os.Stderr, "\nCommands:")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", c.name, c.usage)
+	}
+	fmt.Fprintln(os.Stderr, "\nRun 'ContigMapper <command> -h' for the flags of each command.")
+	fmt.Fprintln(os.Stderr, "Without a command, the flags are those of place.")
+	fmt.Fprintln(os.Stderr, "\nInputs compressed with gzip, bgzip or zstd are decompressed transparently. zstd needs the zstd program in the PATH.")
+	fmt.Fprintf(os.Stderr, "\nExit codes: 0 success, %d usage error, %d input error, %d processing error.\n", exitUsage, exitInput, exitProcessing)
+}
+
+func main() {
+	// Keep the old invocation without command working as place
+	if len(os.Args) < 2 || strings.HasPrefix(os.Args[1], "-") && os.Args[1] != "-h" && os.Args[1] != "-help" && os.Args[1] != "--help" {
+		Place(os.Args[1:])
+		return
+	}
+	for _, c := range commands {
+		if c.name == os.Args[1] {
+			c.run(os.Args[2:])
+			return
+		}
+	}
+	usage()
+	if os.Args[1] != "-h" && os.Args[1] != "-help" && os.Args[1] != "--help" && os.Args[1] != "help" {
+		fatal(exitUsage, "unknown command: "+os.Args[1])
 	}
-	wg.Wait()
-	out.Close()
-	fmt.Println("Done")
-	fmt.Println("All done. Check the log for errors.")
 }
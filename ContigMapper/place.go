@@ -0,0 +1,508 @@
+package main
+
+import (
+	"ContigMapping"
+	"fmt"
+	"io"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+)
+
+// Optional inputs and outputs for the pseudomolecules
+var lengthsFile, fastaFile, agpFile, pseudoFile string
+var bedFile, markerBedFile, gffFile string
+var gapWindow float64
+var outFormat string
+var modelFile, modelFormat string
+var fromFile, snapshotFile string
+var overridesFile string
+
+// Optional evidence to order the contigs that share a genetic position
+var refPaf, hicLinks, barcodeFile, adjFile string
+
+// Placement of the contigs without markers with the reference alignment
+var refPlace bool
+var refMinQ uint64
+
+// Optional Hi-C contacts to orient the contigs left without orientation by the map
+var hicPairs, hicEnds string
+
+// File for the per-contig diagnostics
+var logFile string
+
+// Files for the summary statistics of the run
+var statsFile, summaryFile string
+
+// Directory for the Marey plots and tolerance (cM) for the outlier markers
+var mareyDir string
+var outlierTol float64
+
+// File for the ideogram of the linkage groups
+var ideogramFile string
+
+// Files for the CPU and memory profiles
+var cpuProfile, memProfile string
+
+// Alignments of the contigs to the reference, read only once
+var refAlignments map[string]*ContigMapping.Alignment
+
+func ReadRefPAF() map[string]*ContigMapping.Alignment {
+	if refAlignments != nil {
+		return refAlignments
+	}
+	readInput("refpaf", refPaf, func(r io.Reader) (err error) {
+		refAlignments, err = ContigMapping.ReadPAF(r, refMinQ)
+		return err
+	})
+	return refAlignments
+}
+
+// Read the sources of evidence given in the command line to order the contigs inside each bin
+func ReadEvidence() (out []ContigMapping.Evidence) {
+	if refPaf != "" {
+		out = append(out, &ContigMapping.RefEvidence{Alignments: ReadRefPAF()})
+	}
+	if hicLinks != "" {
+		readInput("hiclinks", hicLinks, func(r io.Reader) error {
+			links, err := ContigMapping.ReadLinks(r, "hic")
+			out = append(out, links)
+			return err
+		})
+	}
+	if barcodeFile != "" {
+		readInput("barcodes", barcodeFile, func(r io.Reader) error {
+			links, err := ContigMapping.ReadBarcodes(r)
+			out = append(out, links)
+			return err
+		})
+	}
+	return out
+}
+
+// Read the contig lengths given in the command line, if any
+func ReadLengths() (out map[string]uint64) {
+	out = make(map[string]uint64)
+	if lengthsFile != "" {
+		readInput("lengths", lengthsFile, func(r io.Reader) (err error) {
+			out, err = ContigMapping.ReadLengths(r)
+			return err
+		})
+	}
+	return out
+}
+
+// Read the Hi-C contacts given in the command line, if any
+func ReadHiC() (h *ContigMapping.HiC) {
+	switch {
+	case hicPairs != "":
+		lengths := ReadLengths()
+		readInput("hicpairs", hicPairs, func(r io.Reader) (err error) {
+			h, err = ContigMapping.ReadPairs(r, lengths)
+			return err
+		})
+	case hicEnds != "":
+		readInput("hicends", hicEnds, func(r io.Reader) (err error) {
+			h, err = ContigMapping.ReadEndLinks(r)
+			return err
+		})
+	}
+	return h
+}
+
+// Orient the contigs without orientation with the Hi-C contacts and report the conflicts with the map in the log and
+// as "## hic conflict:" lines of the outputs
+func OrientHiC(lgMap map[string]*ContigMapping.ContigMap, h *ContigMapping.HiC) {
+	n := 0
+	for _, name := range sortedLGs(lgMap) {
+		for _, c := range lgMap[name].OrientHiC(h) {
+			conflict := "LG " + name + " contig " + c.Contig + " is " + c.Map + " in the map and " + c.HiC + " with Hi-C"
+			fmt.Fprintln(diagLog, "Orientation conflict in "+conflict)
+			runHeader.Notes = append(runHeader.Notes, "hic conflict: "+conflict)
+			n++
+		}
+	}
+	if n > 0 {
+		progress(fmt.Sprintf("%d orientation conflicts between the map and Hi-C", n))
+	}
+}
+
+// Order the contigs inside each bin and write the source of every adjacency if requested
+func OrderBins(lgMap map[string]*ContigMapping.ContigMap, evidence []ContigMapping.Evidence) {
+	var out io.WriteCloser
+	if adjFile != "" {
+		out = createOutputFlag("adjacencies", adjFile)
+		defer closeOutput("adjacencies", out)
+		fmt.Fprint(out, runHeader.Comment("##"))
+	}
+	for _, name := range sortedLGs(lgMap) {
+		for _, a := range lgMap[name].OrderBins(evidence...) {
+			if out != nil {
+				fmt.Fprintf(out, "%s\t%s\t%s\t%s\n", name, a.Before, a.After, a.Source)
+			}
+		}
+	}
+}
+
+// Open the contig sequences (-fasta) and read the lengths (-lengths), if given, and set the length of the contigs.
+// The indexed fasta is returned to copy the sequences to the pseudomolecules
+func LoadSequences(cMap map[string]*ContigMapping.Contig) (seqs *ContigMapping.Fasta) {
+	if fastaFile != "" {
+		var err error
+		if seqs, err = ContigMapping.OpenFasta(fastaFile); err != nil {
+			fatal(exitInput, "-fasta "+fastaFile+": ", err)
+		}
+		for name, l := range seqs.Lengths() {
+			if c, ok := cMap[name]; ok {
+				c.Length = l
+			}
+		}
+	}
+	for name, l := range ReadLengths() {
+		if c, ok := cMap[name]; ok {
+			c.Length = l
+		}
+	}
+	return seqs
+}
+
+// Write the summary statistics of the run as a table (-stats) and as text (-summary). The overall summary is also a progress message
+func WriteStats(lgMap map[string]*ContigMapping.ContigMap, cMap map[string]*ContigMapping.Contig) {
+	stats, total := ContigMapping.Summarise(lgMap, cMap)
+	if statsFile != "" {
+		out := createOutputFlag("stats", statsFile)
+		fmt.Fprint(out, runHeader.Comment("##"))
+		err := ContigMapping.WriteStats(out, stats, total)
+		if e := out.Close(); err == nil {
+			err = e
+		}
+		if err != nil {
+			fatal(exitProcessing, "-stats: ", err)
+		}
+	}
+	if summaryFile != "" {
+		out := createOutputFlag("summary", summaryFile)
+		fmt.Fprint(out, runHeader.Comment("##"))
+		for _, s := range stats {
+			fmt.Fprintln(out, s.Summary())
+		}
+		fmt.Fprint(out, total.Summary())
+		if err := out.Close(); err != nil {
+			fatal(exitProcessing, "-summary: ", err)
+		}
+	}
+	progress(total.Summary())
+}
+
+// Write the model of the LGs after the contigs are completed and before they are filtered, so that it can be reloaded
+func WriteModel(lgMap map[string]*ContigMapping.ContigMap) {
+	progress("Writing the model...")
+	out := createOutputFlag("model", modelFile)
+	err := ContigMapping.WriteModel(out, lgMap, sortedLGs(lgMap), modelFormat == "jsonl", runHeader)
+	if e := out.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		fatal(exitProcessing, "-model: ", err)
+	}
+	progress("Done")
+}
+
+// Read the snapshot given in -from, with the maps before filtering and all the contigs
+func LoadSnapshot() (lgMap map[string]*ContigMapping.ContigMap, cMap map[string]*ContigMapping.Contig) {
+	progress("Reading the snapshot...")
+	readInput("from", fromFile, func(r io.Reader) (err error) {
+		lgMap, _, cMap, err = ContigMapping.ReadSnapshot(r)
+		return err
+	})
+	for name, LG := range lgMap {
+		if LG.Filtered {
+			fatal(exitInput, "-from: LG "+name+" is already filtered, the snapshot must be written by -snapshot")
+		}
+	}
+	progress("Done")
+	return lgMap, cMap
+}
+
+// Apply the curation overrides of -overrides. Each one is logged and added to the header of the outputs
+func ApplyOverrides(lgMap map[string]*ContigMapping.ContigMap, cMap map[string]*ContigMapping.Contig) {
+	progress("Applying the curation overrides...")
+	var overrides []ContigMapping.Override
+	readInput("overrides", overridesFile, func(r io.Reader) (err error) {
+		overrides, err = ContigMapping.ReadOverrides(r)
+		return err
+	})
+	log, err := ContigMapping.ApplyOverrides(lgMap, cMap, overrides)
+	if err != nil {
+		fatal(exitInput, "-overrides "+overridesFile+": ", err)
+	}
+	for _, l := range log {
+		fmt.Fprintln(diagLog, "Curation override "+l)
+		runHeader.Notes = append(runHeader.Notes, "curation: "+l)
+	}
+	progress(fmt.Sprintf("Done: %d overrides applied", len(log)))
+}
+
+// Write the snapshot of the run to -snapshot
+func WriteSnapshot(lgMap map[string]*ContigMapping.ContigMap, cMap map[string]*ContigMapping.Contig) {
+	progress("Writing the snapshot...")
+	out := createOutputFlag("snapshot", snapshotFile)
+	err := ContigMapping.WriteSnapshot(out, lgMap, sortedLGs(lgMap), cMap, runHeader)
+	if e := out.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		fatal(exitProcessing, "-snapshot: ", err)
+	}
+	progress("Done")
+}
+
+// Write the genome browser tracks of the contigs (BED and GFF3) and of the markers (BED) on the pseudomolecules,
+// with the gaps estimated from the recombination rate
+func WriteTracks(lgMap map[string]*ContigMapping.ContigMap) {
+	for _, f := range [][2]string{{"bed", bedFile}, {"gff3", gffFile}} {
+		if f[1] == "" {
+			continue
+		}
+		out := createOutputFlag(f[0], f[1])
+		w, err := ContigMapping.NewWriter(f[0], out, runHeader)
+		if err == nil {
+			err = WriteContigMaps(w, lgMap, true)
+		}
+		if e := out.Close(); err == nil {
+			err = e
+		}
+		if err != nil {
+			fatal(exitProcessing, "-"+f[0]+": ", err)
+		}
+	}
+	if markerBedFile == "" {
+		return
+	}
+	out := createOutputFlag("markerbed", markerBedFile)
+	_, err := io.WriteString(out, runHeader.Comment("##"))
+	for _, name := range sortedLGs(lgMap) {
+		if err != nil {
+			break
+		}
+		LG := lgMap[name]
+		err = LG.WriteMarkerBED(out, LG.EstimateGaps(gapWindow))
+	}
+	if e := out.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		fatal(exitProcessing, "-markerbed: ", err)
+	}
+}
+
+// Write the AGP and fasta files of the pseudomolecules, with the gaps estimated from the recombination rate
+func WritePseudomolecules(lgMap map[string]*ContigMapping.ContigMap, seqs *ContigMapping.Fasta) {
+
+	var agp, pseudo io.WriteCloser
+	if agpFile != "" {
+		agp = createOutputFlag("agp", agpFile)
+		defer closeOutput("agp", agp)
+		fmt.Fprint(agp, "##agp-version 2.0\n"+runHeader.Comment("##"))
+	}
+	if pseudoFile != "" {
+		pseudo = createOutputFlag("pseudo", pseudoFile)
+		defer closeOutput("pseudo", pseudo)
+	}
+	for _, name := range sortedLGs(lgMap) {
+		LG := lgMap[name]
+		gaps := LG.EstimateGaps(gapWindow)
+		if agp != nil {
+			if err := LG.WriteAGP(agp, gaps); err != nil {
+				fatal(exitProcessing, "-agp: ", err)
+			}
+		}
+		if pseudo != nil {
+			if err := LG.WriteFasta(pseudo, seqs, gaps, 60); err != nil {
+				fatal(exitProcessing, "-pseudo: ", err)
+			}
+		}
+	}
+}
+
+// Write a Marey plot of each LG in the -marey directory, with the same gaps as the pseudomolecules
+func WriteMarey(lgMap map[string]*ContigMapping.ContigMap) {
+	for _, name := range sortedLGs(lgMap) {
+		LG := lgMap[name]
+		file := filepath.Join(mareyDir, filepath.Base(name)+".svg")
+		out := createOutputFlag("marey", file)
+		err := LG.WriteMarey(out, LG.EstimateGaps(gapWindow), outlierTol, runHeader)
+		if e := out.Close(); err == nil {
+			err = e
+		}
+		if err != nil {
+			fatal(exitProcessing, "-marey "+file+": ", err)
+		}
+	}
+}
+
+// Write the ideogram of all the LGs in the -ideogram file
+func WriteIdeogram(lgMap map[string]*ContigMapping.ContigMap) {
+	var maps []*ContigMapping.ContigMap
+	for _, name := range sortedLGs(lgMap) {
+		maps = append(maps, lgMap[name])
+	}
+	out := createOutputFlag("ideogram", ideogramFile)
+	err := ContigMapping.WriteIdeogram(out, maps, runHeader)
+	if e := out.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		fatal(exitProcessing, "-ideogram: ", err)
+	}
+}
+
+// Start the CPU profile if requested. The returned function stops it and writes the memory profile
+func startProfiling() func() {
+	var cpu io.WriteCloser
+	if cpuProfile != "" {
+		cpu = createOutputFlag("cpuprofile", cpuProfile)
+		if err := pprof.StartCPUProfile(cpu); err != nil {
+			fatal(exitProcessing, "-cpuprofile: ", err)
+		}
+	}
+	return func() {
+		if cpu != nil {
+			pprof.StopCPUProfile()
+			if err := cpu.Close(); err != nil {
+				fatal(exitProcessing, "-cpuprofile: ", err)
+			}
+		}
+		if memProfile != "" {
+			mem := createOutputFlag("memprofile", memProfile)
+			runtime.GC()
+			err := pprof.WriteHeapProfile(mem)
+			if e := mem.Close(); err == nil {
+				err = e
+			}
+			if err != nil {
+				fatal(exitProcessing, "-memprofile: ", err)
+			}
+		}
+	}
+}
+
+// Description of the place command and of the formats of its main inputs and output
+const placeHelp = `Place the contigs in the genetic map and write the ordered contigs of each LG.
+
+Input formats:
+  -map      Genetic map in JoinMap/MapChart style. Lines starting with ; are comments,
+            "group <name>" starts a linkage group and each marker is "marker<TAB>position(cM)".
+  -markers  Markers on contigs, one per line: "marker<TAB>contig<TAB>position(bp)<TAB>weight".
+            The weight is a non-negative integer, larger for more reliable markers.
+
+Output format (-out):
+  "### LG: <name>" and "### Deleted Sequences: <n>" for each LG, followed by one line per
+  contig: "contig<TAB>position(cM)<TAB>orientation". Contigs placed with -refplace have a fourth
+  column "reference". Lines starting with ## describe the run.
+
+Snapshots:
+  -snapshot saves the contigs as they are after parsing and placing them in the LGs, before filtering.
+  -from reads it instead of -map and -markers and runs only filtering, ordering and the outputs, so
+  their flags can be changed without parsing the inputs again. The positions keep the -precision of
+  the run that wrote the snapshot. -format chooses another output:
+  tsv (LG, contig, position, orientation), json, agp or bed (the contigs in the pseudomolecules).
+
+Curation overrides (-overrides):
+  One per line: "contig<TAB>action[<TAB>value]", applied in order after the snapshot is written and
+  before filtering, so that -from with -overrides reruns only the curated steps. The actions are
+  force-LG <LG> [cM], force-orientation <+|->, exclude, pin-after <contig>, pin-before <contig> and
+  split-at <bp>, which replaces the contig by <contig>_1 and <contig>_2. Contigs with overrides are
+  kept by filtering. Each override is logged in -log and as a "## curation:" line of the outputs.`
+
+// Run the whole placement pipeline
+func Place(args []string) {
+	fs := newFlagSet("place", "-map <file> -markers <file> -out <file> [flags]", placeHelp)
+	mapHandle, markerHandle, outfile, t := ReadCmdLine(fs, args)
+	runtime.GOMAXPROCS(t)
+	stopProfiling := startProfiling()
+	var lgMap map[string]*ContigMapping.ContigMap
+	var cMap map[string]*ContigMapping.Contig
+	if fromFile != "" {
+		lgMap, cMap = LoadSnapshot()
+	} else {
+		lgMap, cMap = Load(mapHandle, markerHandle, diagLog)
+	}
+	seqs := LoadSequences(cMap)
+	if seqs != nil {
+		defer seqs.Close()
+	}
+	if modelFile != "" {
+		WriteModel(lgMap)
+	}
+	if snapshotFile != "" {
+		WriteSnapshot(lgMap, cMap)
+	}
+	if overridesFile != "" {
+		ApplyOverrides(lgMap, cMap)
+	}
+	if refPlace {
+		progress("Placing contigs without markers with the reference...")
+		placed := ContigMapping.PlaceByReference(lgMap, ReadRefPAF(), cMap)
+		for _, c := range placed {
+			fmt.Fprintln(diagLog, "Reference-placed contig "+c.Name+" in LG "+c.LG+" at "+ContigMapping.FormatPos(c.GenPos)+" "+c.Orientation)
+		}
+		progress("Done")
+	}
+	evidence := ReadEvidence()
+	hic := ReadHiC()
+	if hic != nil {
+		evidence = append(evidence, hic.Links())
+	}
+	if len(evidence) > 0 || adjFile != "" {
+		progress("Ordering contigs in the same bin...")
+		OrderBins(lgMap, evidence)
+		progress("Done")
+	}
+	if hic != nil {
+		progress("Orienting contigs with Hi-C...")
+		OrientHiC(lgMap, hic)
+		progress("Done")
+	}
+	progress("Writing the maps...")
+	out := createOutputFlag("out", outfile)
+	w, err := ContigMapping.NewWriter(outFormat, out, runHeader)
+	if err == nil {
+		err = WriteContigMaps(w, lgMap, ContigMapping.NeedsLengths(outFormat))
+	}
+	if e := out.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		fatal(exitProcessing, "-out: ", err)
+	}
+	progress("Done")
+	if agpFile != "" || pseudoFile != "" {
+		progress("Writing the pseudomolecules...")
+		WritePseudomolecules(lgMap, seqs)
+		progress("Done")
+	}
+	if bedFile != "" || markerBedFile != "" || gffFile != "" {
+		progress("Writing the genome browser tracks...")
+		WriteTracks(lgMap)
+		progress("Done")
+	}
+	if mareyDir != "" {
+		progress("Drawing the Marey plots...")
+		WriteMarey(lgMap)
+		progress("Done")
+	}
+	if ideogramFile != "" {
+		progress("Drawing the ideogram...")
+		WriteIdeogram(lgMap)
+		progress("Done")
+	}
+	WriteStats(lgMap, cMap)
+	stopProfiling()
+	if logFile != "" {
+		stopLogging(logFile)
+		progress("All done. Check " + logFile + " for the details of each contig.")
+		return
+	}
+	progress("All done.")
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"ContigMapping"
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+// Simulate a data set and load it as place does
+func simulateLoad(t *testing.T, p ContigMapping.SimParams, seed int64) (*ContigMapping.Simulation, map[string]*ContigMapping.ContigMap, map[string]*ContigMapping.Contig) {
+	t.Helper()
+	sim, err := ContigMapping.Simulate(p, rand.New(rand.NewSource(seed)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var genMap, markers bytes.Buffer
+	if err := sim.WriteMap(&genMap); err != nil {
+		t.Fatal(err)
+	}
+	if err := sim.WriteMarkers(&markers); err != nil {
+		t.Fatal(err)
+	}
+	verbosity = 0
+	lgMap, cMap := Load(io.NopCloser(&genMap), io.NopCloser(&markers), io.Discard)
+	return sim, lgMap, cMap
+}
+
+// Index the simulated contigs by name
+func truth(sim *ContigMapping.Simulation) map[string]*ContigMapping.SimContig {
+	out := make(map[string]*ContigMapping.SimContig)
+	for _, c := range sim.Contigs {
+		out[c.Name] = c
+	}
+	return out
+}
+
+func TestSimulatedAssignLG(t *testing.T) {
+	for _, landscape := range []string{ContigMapping.LandscapeUniform, ContigMapping.LandscapeTelomeric} {
+		p := ContigMapping.DefaultSimParams()
+		p.Landscape = landscape
+		sim, _, cMap := simulateLoad(t, p, 1)
+		truth := truth(sim)
+		for name, c := range cMap {
+			if !c.Placeable && c.Reason == ContigMapping.ReasonConflictingLG {
+				t.Errorf("%s: contig %s has conflicting LGs without errors", landscape, name)
+			}
+			if c.LG != "-" && c.LG != truth[name].Pieces[0].LG {
+				t.Errorf("%s: contig %s assigned to %s, it is in %s", landscape, name, c.LG, truth[name].Pieces[0].LG)
+			}
+		}
+	}
+}
+
+func TestSimulatedOrient(t *testing.T) {
+	for _, landscape := range []string{ContigMapping.LandscapeUniform, ContigMapping.LandscapeTelomeric} {
+		p := ContigMapping.DefaultSimParams()
+		p.Landscape = landscape
+		sim, _, cMap := simulateLoad(t, p, 2)
+		truth := truth(sim)
+		var oriented, wrong int
+		for name, c := range cMap {
+			if c.Orientation == "" {
+				continue
+			}
+			oriented++
+			if c.Orientation != truth[name].Pieces[0].Strand {
+				wrong++
+			}
+		}
+		if oriented == 0 || float64(wrong)/float64(oriented) > 0.05 {
+			t.Errorf("%s: %d of %d oriented contigs have the wrong orientation", landscape, wrong, oriented)
+		}
+	}
+}
+
+func TestSimulatedFilter(t *testing.T) {
+	p := ContigMapping.DefaultSimParams()
+	sim, lgMap, _ := simulateLoad(t, p, 3)
+	truth := truth(sim)
+	for _, name := range sortedLGs(lgMap) {
+		contigs := lgMap[name].Ordered()
+		if len(contigs) < 2 {
+			t.Errorf("LG %s: %d contigs left after filtering", name, len(contigs))
+			continue
+		}
+		var ranks []int
+		for _, c := range contigs {
+			if truth[c.Name].Pieces[0].LG != name {
+				t.Errorf("LG %s: contig %s of %s kept by the filter", name, c.Name, truth[c.Name].Pieces[0].LG)
+			}
+			rank := 0
+			for _, d := range contigs {
+				if truth[d.Name].Pieces[0].Start < truth[c.Name].Pieces[0].Start {
+					rank++
+				}
+			}
+			ranks = append(ranks, rank)
+		}
+		if tau := ContigMapping.KendallTau(ranks); tau < 0.95 {
+			t.Errorf("LG %s: Kendall tau %.3f between the placed and the true order", name, tau)
+		}
+	}
+}
+
+func TestSimulatedErrors(t *testing.T) {
+	p := ContigMapping.DefaultSimParams()
+	p.ErrorRate, p.ChimeraRate, p.MultiMapRate = 0.05, 0.02, 0.02
+	sim, lgMap, _ := simulateLoad(t, p, 4)
+	truth := truth(sim)
+	var placed, wrong int
+	for _, CM := range lgMap {
+		for _, c := range CM.Ordered() {
+			placed++
+			if truth[c.Name].Pieces[0].LG != c.LG && (len(truth[c.Name].Pieces) == 1 || truth[c.Name].Pieces[1].LG != c.LG) {
+				wrong++
+			}
+		}
+	}
+	if placed == 0 || float64(wrong)/float64(placed) > 0.05 {
+		t.Errorf("%d of %d placed contigs are in the wrong LG", wrong, placed)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	verbosity = 0
+	genMap := "; comment\ngroup 1\nm1\t1.0\nm2\t2.0\n\ngroup 2\nm3\t1.5\n"
+	markers := "m1\tc1\t10\t5\nm2\tc1\t500\t5\nm3\tc2\t10\t5\n"
+	tests := []struct {
+		name, genMap, markers string
+		problems              []string
+	}{
+		{"valid", genMap, markers, nil},
+		{"blank marker lines", genMap, "\n" + markers + "\n\n", nil},
+		{"NaN map position", genMap + "m4\tNaN\n", markers, []string{`map:8: wrong position "NaN"`}},
+		{"infinite map position", genMap + "m4\t+Inf\n", markers, []string{`map:8: wrong position "+Inf"`}},
+		{"negative contig position", genMap, markers + "m1\tc3\t-10\t5\n", []string{`markers:4: wrong contig position "-10"`}},
+		{"all the problems", "group\n" + genMap + "m4\tx\n", markers + "m1\tc3\t-1\t5\nm2\tc3\t1\n",
+			[]string{"map:1: group without name", `map:9: wrong position "x"`, `markers:4: wrong contig position "-1"`,
+				"markers:5: expected marker<TAB>contig<TAB>position<TAB>weight"}},
+	}
+	for _, tt := range tests {
+		v := newValidation()
+		if err := v.checkMap("map", strings.NewReader(tt.genMap)); err != nil {
+			t.Fatal(err)
+		}
+		if err := v.checkMarkers("markers", strings.NewReader(tt.markers)); err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(v.problems, "\n") != strings.Join(tt.problems, "\n") {
+			t.Errorf("%s: problems %q, want %q", tt.name, v.problems, tt.problems)
+		}
+		// place reads the inputs with the same parsers, so it fails exactly when validate finds a problem
+		_, _, err := load(strings.NewReader(tt.genMap), strings.NewReader(tt.markers), io.Discard)
+		if (err != nil) != (len(tt.problems) > 0) {
+			t.Errorf("%s: load error %v with validate problems %q", tt.name, err, v.problems)
+		}
+	}
+	v := newValidation()
+	v.checkMap("map", strings.NewReader(genMap))
+	v.checkMarkers("markers", strings.NewReader(markers+"m1\tc4\t1\t1\nm5\tc4\t1\t1\nm5\tc5\t1\t1\n"))
+	if len(v.mapMarkers) != 3 || len(v.hit) != 3 || len(v.missing) != 1 || len(v.contigs) != 4 {
+		t.Errorf("counts: %d in the map, %d hit, %d missing, %d contigs", len(v.mapMarkers), len(v.hit), len(v.missing), len(v.contigs))
+	}
+}
@@ -0,0 +1,121 @@
+package ContigMapping
+
+import (
+	"math"
+	"strconv"
+)
+
+// Kinds of differences between two placements
+const (
+	Disappeared = "disappeared"
+	Appeared    = "appeared"
+	MovedLG     = "moved"
+	Reordered   = "reordered"
+	Flipped     = "flipped"
+)
+
+// Struct with a difference for a contig between placements A and B. A and B are the LG, the orientation or the rank
+// in the LG depending on the kind
+type Difference struct {
+	Kind   string
+	Contig string
+	A      string
+	B      string
+}
+
+// Struct with the agreement between the orders of the contigs of a LG shared by both placements
+type OrderAgreement struct {
+	LG     string
+	Shared int
+	Tau    float64
+}
+
+// Kendall rank correlation (tau-a) between two orders of the same elements. b holds the rank in the second
+// order of each element of the first. It is NaN with less than 2 elements
+func KendallTau(b []int) float64 {
+	n := len(b)
+	if n < 2 {
+		return math.NaN()
+	}
+	var concordant, discordant int
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			switch {
+			case b[i] < b[j]:
+				concordant++
+			case b[i] > b[j]:
+				discordant++
+			}
+		}
+	}
+	return float64(concordant-discordant) / float64(n*(n-1)/2)
+}
+
+// Index the contigs of the placement by name
+func indexContigs(maps map[string]*ContigMap) map[string]*Contig {
+	out := make(map[string]*Contig)
+	for _, CM := range maps {
+		for _, c := range *CM.Contigs {
+			out[c.Name] = c
+		}
+	}
+	return out
+}
+
+// Order of the contigs of the LG that are also in the same LG of the other placement
+func sharedOrder(CM *ContigMap, other map[string]*Contig) (out []string) {
+	for _, c := range CM.Ordered() {
+		if d, ok := other[c.Name]; ok && d.LG == c.LG {
+			out = append(out, c.Name)
+		}
+	}
+	return out
+}
+
+// Compare two placements given as ContigMaps by LG and the LG names in order. It reports the contigs that disappeared,
+// moved to another LG, moved more than threshold places in the order of the contigs shared by both placements in their LG,
+// flipped orientation (both oriented) or appeared, and the Kendall tau between the shared orders of each LG of a
+func Compare(a, b map[string]*ContigMap, namesA, namesB []string, threshold int) (diffs []Difference, agreement []OrderAgreement) {
+	contigsA, contigsB := indexContigs(a), indexContigs(b)
+	for _, name := range namesA {
+		orderA := sharedOrder(a[name], contigsB)
+		rankB := make(map[string]int)
+		if CM, ok := b[name]; ok {
+			for i, c := range sharedOrder(CM, contigsA) {
+				rankB[c] = i
+			}
+		}
+		rankA := make(map[string]int)
+		ranks := make([]int, len(orderA))
+		for i, c := range orderA {
+			rankA[c] = i
+			ranks[i] = rankB[c]
+		}
+		agreement = append(agreement, OrderAgreement{name, len(orderA), KendallTau(ranks)})
+		for _, c := range a[name].Ordered() {
+			d, ok := contigsB[c.Name]
+			switch {
+			case !ok:
+				diffs = append(diffs, Difference{Disappeared, c.Name, c.LG, "-"})
+				continue
+			case d.LG != c.LG:
+				diffs = append(diffs, Difference{MovedLG, c.Name, c.LG, d.LG})
+				continue
+			}
+			if shift := rankA[c.Name] - rankB[c.Name]; shift > threshold || -shift > threshold {
+				diffs = append(diffs, Difference{Reordered, c.Name, strconv.Itoa(rankA[c.Name] + 1), strconv.Itoa(rankB[c.Name] + 1)})
+			}
+			if c.Orientation != "" && d.Orientation != "" && c.Orientation != d.Orientation {
+				diffs = append(diffs, Difference{Flipped, c.Name, c.Orientation, d.Orientation})
+			}
+		}
+	}
+	for _, name := range namesB {
+		for _, c := range b[name].Ordered() {
+			if _, ok := contigsA[c.Name]; !ok {
+				diffs = append(diffs, Difference{Appeared, c.Name, "-", c.LG})
+			}
+		}
+	}
+	return diffs, agreement
+}
@@ -1,18 +1,25 @@
 package ContigMapping
 
 import (
+	"bufio"
 	"fmt"
+	"io"
+	"math"
 	"sort"
 	"strconv"
 )
 
+// Number of decimals kept for genetic positions (in cM). Positions are rounded to this precision when parsed
+// and printed with it in all the outputs.
+var Precision = 3
+
 // Type definitions
 
 // Struct with data about each Marker: genetic position, contig position and number of missing data
 type Marker struct {
 	Name   string
-	ConPos uint64
-	GenPos uint64
+	ConPos float64
+	GenPos float64
 	Weight uint64
 	LG     string
 	Contig string
@@ -20,30 +27,59 @@ type Marker struct {
 
 // Struct with data about each contig. It has a name and a map with all the Marker objects in it
 type Contig struct {
+	Markers      *map[string]*Marker
+	Name         string
+	GenPos       float64
+	AvgWeight    uint64
+	Orientation  string
+	Range        [2]*Marker
+	LG           string
+	Placeable    bool
+	Length       uint64
+	BinRank      int
+	OrientSource string
+	RefPlaced    bool
+	Reason       string
+	Curated      bool // Changed by a curation override. Curated contigs are never removed by filterContigs
+}
+
+// Reasons why a contig cannot be placed, stored in the Reason field of the Contig struct
+const (
+	ReasonConflictingLG          = "conflicting LG"
+	ReasonConflictingOrientation = "conflicting orientation"
+	ReasonNoMapPosition          = "no map position"
+	ReasonUnknownLG              = "unknown LG"
+	ReasonExcluded               = "excluded by curation"
+)
+
+// Struct data about a map of contigs
+type ContigMap struct {
+	Contigs     *map[string]*Contig
 	Markers     *map[string]*Marker
+	Filtered    bool
+	Deleted     int
 	Name        string
-	GenPos      uint64
-	AvgWeight   uint64
-	Orientation string
-	Range       [2]*Marker
-	LG          string
-	Placeable   bool
+	Adjacencies []Adjacency
+	Pins        []Pin // Contigs pinned next to others by the curators, applied in this order
 }
 
-//Struct data about a map of contigs
-type ContigMap struct {
-	Contigs  *map[string]*Contig
-	Markers  *map[string]*Marker
-	Filtered bool
-	Name     string
+// Round a genetic position to the number of decimals set in Precision
+func Round(x float64) float64 {
+	p := math.Pow(10, float64(Precision))
+	return math.Round(x*p) / p
+}
+
+// Format a genetic position in cM using the number of decimals set in Precision
+func FormatPos(x float64) string {
+	return strconv.FormatFloat(x, 'f', Precision, 64)
 }
 
 // Printing methods
 
 func (m *Marker) String() string {
 	out := "{ Name: " + m.Name
-	out += ", ConPos: " + strconv.FormatUint(m.ConPos, 10)
-	out += ", GenPos: " + strconv.FormatUint(m.GenPos, 10)
+	out += ", ConPos: " + strconv.FormatFloat(m.ConPos, 'f', -1, 64)
+	out += ", GenPos: " + FormatPos(m.GenPos)
 	out += ", Weight: " + strconv.FormatUint(m.Weight, 10)
 	out += ", LG: " + m.LG + ", Contig: " + m.Contig + " }\n"
 	return out
@@ -53,10 +89,10 @@ func (c *Contig) String() string {
 	out := "{ Name: " + c.Name
 	out += ", Placeable: " + strconv.FormatBool(c.Placeable)
 	out += ", Markers: " + strconv.Itoa(len(*c.Markers))
-	out += ", GenPos: " + strconv.FormatUint(c.GenPos, 10)
+	out += ", GenPos: " + FormatPos(c.GenPos)
 	out += ", AvgWeight: " + strconv.FormatUint(c.AvgWeight, 10)
 	out += ", Orientation: " + c.Orientation + ", LG: " + c.LG
-	out += ", Range: [ " + strconv.FormatUint(c.Range[0].GenPos, 10) + ", " + strconv.FormatUint(c.Range[1].GenPos, 10) + " ] }\n"
+	out += ", Range: [ " + FormatPos(c.Range[0].GenPos) + ", " + FormatPos(c.Range[1].GenPos) + " ] }\n"
 	return out
 }
 
@@ -68,7 +104,7 @@ func (CM *ContigMap) String() string {
 	return out
 }
 
-//Methods to implemeent sort interface on list of uint64
+// Methods to implemeent sort interface on list of uint64
 type Uintarr []uint64
 
 func (a Uintarr) Len() int {
@@ -171,8 +207,8 @@ func NewContigMap() *ContigMap {
 }
 
 // Build and set the Map field in the ContigMap struct
-func (CM *ContigMap) buildMap() *map[uint64][]*Contig {
-	M := make(map[uint64][]*Contig)
+func (CM *ContigMap) buildMap() *map[float64][]*Contig {
+	M := make(map[float64][]*Contig)
 	C := CM.Contigs
 	if !CM.Filtered {
 		for _, c := range *C {
@@ -205,14 +241,14 @@ func (CM *ContigMap) filterContigs() (out int) {
 	}
 
 	draftMap := CM.buildMap()
-	var sortedKeys []uint64
+	var sortedKeys []float64
 	contig := &Contig{AvgWeight: 0, GenPos: 0, Range: [2]*Marker{&Marker{GenPos: 0}, &Marker{GenPos: 0}}}
 
 	// fill the array of keys to be sorted
 	for i, _ := range *draftMap {
 		sortedKeys = append(sortedKeys, i)
 	}
-	sort.Sort(Uintarr(sortedKeys))
+	sort.Float64s(sortedKeys)
 
 	//Loop through the sorted array.
 	for _, i := range sortedKeys {
@@ -234,6 +270,10 @@ func (CM *ContigMap) filterContigs() (out int) {
 				out++
 				continue
 
+			// Keep the contigs placed by the curators
+			case c.Curated:
+				continue
+
 			// Keep contigs that have all markers in the same genetic position
 			case c.Range[1].GenPos == c.Range[0].GenPos:
 				continue
@@ -307,32 +347,50 @@ func (CM *ContigMap) filterContigs() (out int) {
 		}
 	}
 	CM.Filtered = true
+	CM.Deleted = out
 	return out
 }
 
-// Method to write the final ContigMap
-func (CM *ContigMap) WriteMap() (out string) {
-	deleted := CM.filterContigs()
-	out = "### LG: " + CM.Name + "\n### Deleted Sequences: " + strconv.Itoa(deleted) + "\n"
-	finalMap := CM.buildMap()
-	var keys []uint64
-	for i, _ := range *finalMap {
-		keys = append(keys, i)
-	}
-	sort.Sort(Uintarr(keys))
-	for _, k := range keys {
-		var s string = ""
-		for _, c := range (*finalMap)[k] {
-			s = ""
-			s += c.Name
-			s += "\t"
-			s += strconv.FormatUint(c.GenPos, 10)
-			s += "\t"
-			s += c.Orientation
-			out += s + "\n"
-		}
+// Remove the contigs that are apparently misplaced, unless it was done already. Returns the number of contigs removed
+func (CM *ContigMap) Filter() int {
+	if !CM.Filtered {
+		CM.filterContigs()
 	}
-	return out
+	return CM.Deleted
+}
+
+// Return the contigs of the map sorted by genetic position, without filtering them. Contigs sharing a position are sorted
+// by their BinRank (set by OrderBins) and then by name
+func (CM *ContigMap) sorted() (out []*Contig) {
+	for _, c := range *CM.Contigs {
+		out = append(out, c)
+	}
+	genPos := func(c1, c2 *Contig) bool {
+		return c1.GenPos < c2.GenPos
+	}
+	binRank := func(c1, c2 *Contig) bool {
+		return c1.BinRank < c2.BinRank
+	}
+	name := func(c1, c2 *Contig) bool {
+		return c1.Name < c2.Name
+	}
+	OrderedBy(genPos, binRank, name).Sort(out)
+	return CM.applyPins(out)
+}
+
+// Return the contigs of the filtered map sorted by genetic position. The map is filtered first if it was not already
+func (CM *ContigMap) Ordered() []*Contig {
+	CM.Filter()
+	return CM.sorted()
+}
+
+// Method to write the final ContigMap in the result format, filtering it first if needed. The lines are streamed to w,
+// so memory does not grow with the size of the output
+func (CM *ContigMap) WriteMap(w io.Writer) error {
+	CM.Filter()
+	b := bufio.NewWriter(w)
+	writeMapLG(b, CM.Name, CM.Deleted, CM.Placements(nil))
+	return b.Flush()
 }
 
 // Method to add marker pointers to the contig map
@@ -343,7 +401,7 @@ func (CM *ContigMap) AddMarkers(markers ...*Marker) {
 	}
 }
 
-//Method to add contigs to the contig map
+// Method to add contigs to the contig map
 func (CM *ContigMap) AddContigs(contigs ...*Contig) {
 	C := CM.Contigs
 	for _, c := range contigs {
@@ -381,6 +439,7 @@ func (c *Contig) AssignLG() (lg string) {
 			lg = m.LG
 		case m.LG != lg:
 			c.Placeable = false
+			c.Reason = ReasonConflictingLG
 			c.LG = "-"
 			return "-"
 		case m.LG == lg:
@@ -415,38 +474,45 @@ func (c *Contig) CalculateAvgWeight() uint64 {
 }
 
 // Given a contig, return a weighted mean position in the genetic map
-// the maximum weight is for Markers with 0 missing data (most accurate)
-func (c *Contig) CalculateMapPos() uint64 {
+// the maximum weight is for Markers with 0 missing data (most accurate). Without any weight the mean is unweighted
+func (c *Contig) CalculateMapPos() float64 {
 	if c.LG == "" {
 		c.AssignLG()
 	}
 	if !c.Placeable {
 		return 0.0
 	}
-	var weight uint64 = 0
-	var sum uint64 = 0
+	var weight float64 = 0
+	var sum float64 = 0
+	// Plain mean, used when all the markers have weight 0
+	var n, plain float64
 	for _, m := range *c.Markers {
 		if m.LG == c.LG {
-			sum += m.Weight * m.GenPos
-			weight += m.Weight
+			sum += float64(m.Weight) * m.GenPos
+			weight += float64(m.Weight)
+			plain += m.GenPos
+			n++
 		} else {
 			continue
 		}
 	}
-	c.GenPos = sum / weight
-	return (sum / weight)
+	if weight == 0 {
+		sum, weight = plain, n
+	}
+	c.GenPos = Round(sum / weight)
+	return c.GenPos
 }
 
 // Given a contig return the position in the contig where the weighted genetic position would be placed
-func (c *Contig) CentrePos() uint64 {
+func (c *Contig) CentrePos() float64 {
 	if c.LG == "" {
 		c.AssignLG()
 	}
 	if !c.Placeable {
 		return 0.0
 	}
-	var sum uint64 = 0
-	var tot uint64 = 0
+	var sum float64 = 0
+	var tot float64 = 0
 	for _, m := range *(*c).Markers {
 		if m.LG == c.LG {
 			sum += m.ConPos
@@ -519,7 +585,7 @@ func (c *Contig) Orient() (string, bool) {
 	topMarkers := c.Top()
 
 	// Check that top markers actually have different positions
-	topPos := make(map[uint64]int)
+	topPos := make(map[float64]int)
 	for _, m := range topMarkers {
 		topPos[m.GenPos] = 1
 	}
@@ -538,7 +604,13 @@ func (c *Contig) Orient() (string, bool) {
 	}
 	out, ok := OrientMarkers(topMarkers...)
 	c.Orientation = out
+	if out != "" {
+		c.OrientSource = MapSource
+	}
 	c.Placeable = ok
+	if !ok {
+		c.Reason = ReasonConflictingOrientation
+	}
 	return out, ok
 }
 
@@ -554,7 +626,7 @@ func (c *Contig) CalculateRange() {
 	if c.GenPos == 0 {
 		c.CalculateMapPos()
 	}
-	topPos := make(map[uint64]int)
+	topPos := make(map[float64]int)
 	for _, m := range *c.Markers {
 		topPos[m.GenPos]++
 	}
@@ -589,7 +661,7 @@ func (c *Contig) MaxWeight() (out uint64) {
 func (c *Contig) Autocomplete() (out string) {
 	out = "Processing contig " + c.Name
 	out += "\n\tAssinging LG = " + c.AssignLG()
-	out += "\n\tCalculating Map Position = " + strconv.FormatUint(c.CalculateMapPos(), 10)
+	out += "\n\tCalculating Map Position = " + FormatPos(c.CalculateMapPos())
 	out += "\n\tCalculating Avg weight = " + strconv.FormatUint(c.CalculateAvgWeight(), 10)
 	st, ok := c.Orient()
 	out += "\n\tOrienting contig = " + st + " " + strconv.FormatBool(ok)
@@ -601,7 +673,7 @@ func (c *Contig) Autocomplete() (out string) {
 // General functions using the structs declared here.
 
 // This function is used only by the OrientMarkers function. It returns "+", "-" or "" depending on the difference x-y
-func sign(x, y uint64) string {
+func sign(x, y float64) string {
 	switch {
 	case x < y:
 		return "-"
@@ -0,0 +1,1368 @@
+package ContigMapping
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Build a contig with the markers given as name, LG, position in the contig, genetic position and weight
+func testContig(name string, markers ...Marker) *Contig {
+	c := NewContig()
+	c.Name = name
+	for i := range markers {
+		m := markers[i]
+		m.Contig = name
+		c.AddMarkers(&m)
+	}
+	return c
+}
+
+// Names of the markers, sorted
+func markerNames(markers []*Marker) (out []string) {
+	for _, m := range markers {
+		out = append(out, m.Name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestOrientMarkers(t *testing.T) {
+	tests := []struct {
+		name    string
+		markers []Marker
+		want    string
+		ok      bool
+	}{
+		{"single marker", []Marker{{ConPos: 10, GenPos: 1}}, "", true},
+		{"same direction", []Marker{{ConPos: 10, GenPos: 1}, {ConPos: 500, GenPos: 2}}, "+", true},
+		{"opposite direction", []Marker{{ConPos: 10, GenPos: 2}, {ConPos: 500, GenPos: 1}}, "-", true},
+		{"unsorted input", []Marker{{ConPos: 500, GenPos: 2}, {ConPos: 10, GenPos: 1}, {ConPos: 200, GenPos: 1.5}}, "+", true},
+		{"same genetic position", []Marker{{ConPos: 10, GenPos: 1}, {ConPos: 500, GenPos: 1}}, "", true},
+		{"tie then increase", []Marker{{ConPos: 10, GenPos: 1}, {ConPos: 20, GenPos: 1}, {ConPos: 30, GenPos: 2}}, "+", true},
+		{"not collinear", []Marker{{ConPos: 0, GenPos: 1}, {ConPos: 10, GenPos: 2}, {ConPos: 20, GenPos: 1.5}}, "", false},
+	}
+	for _, tt := range tests {
+		var markers []*Marker
+		for i := range tt.markers {
+			markers = append(markers, &tt.markers[i])
+		}
+		got, ok := OrientMarkers(markers...)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%s: OrientMarkers = %q, %v, want %q, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestTop(t *testing.T) {
+	tests := []struct {
+		name    string
+		lg      string
+		markers []Marker
+		want    []string
+	}{
+		{"single best", "", []Marker{{Name: "a", LG: "1", Weight: 90}, {Name: "b", LG: "1", Weight: 80}}, []string{"a"}},
+		{"tied best", "", []Marker{{Name: "a", LG: "1", Weight: 90}, {Name: "b", LG: "2", Weight: 90}, {Name: "c", LG: "1", Weight: 10}}, []string{"a", "b"}},
+		{"only markers of the LG", "1", []Marker{{Name: "a", LG: "1", Weight: 50}, {Name: "b", LG: "2", Weight: 90}}, []string{"a"}},
+		{"no markers in the LG", "3", []Marker{{Name: "a", LG: "1", Weight: 50}}, nil},
+	}
+	for _, tt := range tests {
+		c := testContig("c", tt.markers...)
+		c.LG = tt.lg
+		if got := markerNames(c.Top()); !equalStrings(got, tt.want) {
+			t.Errorf("%s: Top = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAssignLG(t *testing.T) {
+	tests := []struct {
+		name      string
+		markers   []Marker
+		want      string
+		placeable bool
+		reason    string
+	}{
+		{"one LG", []Marker{{Name: "a", LG: "1", Weight: 90}, {Name: "b", LG: "1", Weight: 90}}, "1", true, ""},
+		{"weaker marker elsewhere", []Marker{{Name: "a", LG: "1", Weight: 90}, {Name: "b", LG: "2", Weight: 10}}, "1", true, ""},
+		{"conflicting top markers", []Marker{{Name: "a", LG: "1", Weight: 90}, {Name: "b", LG: "2", Weight: 90}}, "-", false, ReasonConflictingLG},
+	}
+	for _, tt := range tests {
+		c := testContig("c", tt.markers...)
+		got := c.AssignLG()
+		if got != tt.want || c.LG != tt.want || c.Placeable != tt.placeable || c.Reason != tt.reason {
+			t.Errorf("%s: AssignLG = %q (LG %q, placeable %v, reason %q), want %q (placeable %v, reason %q)",
+				tt.name, got, c.LG, c.Placeable, c.Reason, tt.want, tt.placeable, tt.reason)
+		}
+	}
+	c := testContig("c", Marker{Name: "a", LG: "1", Weight: 90})
+	c.Placeable = false
+	if got := c.AssignLG(); got != "-" || c.LG != "-" {
+		t.Errorf("unplaceable contig: AssignLG = %q, LG %q, want \"-\"", got, c.LG)
+	}
+}
+
+func TestCalculateMapPos(t *testing.T) {
+	tests := []struct {
+		name    string
+		markers []Marker
+		want    float64
+	}{
+		{"weighted", []Marker{{Name: "a", LG: "1", GenPos: 4, Weight: 90}, {Name: "b", LG: "1", GenPos: 14, Weight: 10}}, 5},
+		{"markers of other LGs", []Marker{{Name: "a", LG: "1", GenPos: 4, Weight: 90}, {Name: "b", LG: "2", GenPos: 50, Weight: 10}}, 4},
+		{"all weights 0", []Marker{{Name: "a", LG: "1", GenPos: 4}, {Name: "b", LG: "1", GenPos: 5}, {Name: "c", LG: "1", GenPos: 9}}, 6},
+		{"weights 0 rounded", []Marker{{Name: "a", LG: "1", GenPos: 1}, {Name: "b", LG: "1", GenPos: 1}, {Name: "c", LG: "1", GenPos: 2}}, 1.333},
+	}
+	for _, tt := range tests {
+		c := testContig("c", tt.markers...)
+		if got := c.CalculateMapPos(); got != tt.want || c.GenPos != tt.want {
+			t.Errorf("%s: CalculateMapPos = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCalculateRange(t *testing.T) {
+	tests := []struct {
+		name     string
+		markers  []Marker
+		from, to float64
+		weight   uint64
+	}{
+		{"same genetic position", []Marker{{Name: "a", LG: "1", GenPos: 5, Weight: 90}, {Name: "b", LG: "1", GenPos: 5, Weight: 50}}, 5, 5, 90},
+		{"several top markers", []Marker{{Name: "a", LG: "1", GenPos: 7, Weight: 90}, {Name: "b", LG: "1", GenPos: 5, Weight: 90},
+			{Name: "c", LG: "1", GenPos: 20, Weight: 10}}, 5, 7, 90},
+		// The weighted position is (90*4 + 10*14) / 100 = 5
+		{"one top marker", []Marker{{Name: "a", LG: "1", GenPos: 4, Weight: 90}, {Name: "b", LG: "1", GenPos: 14, Weight: 10}}, 4, 5, 90},
+	}
+	for _, tt := range tests {
+		c := testContig("c", tt.markers...)
+		c.CalculateRange()
+		if c.Range[0] == nil || c.Range[0].GenPos != tt.from || c.Range[1].GenPos != tt.to || c.Range[1].Weight != tt.weight {
+			t.Errorf("%s: Range = %v, want %v-%v with weight %d", tt.name, c.Range, tt.from, tt.to, tt.weight)
+		}
+	}
+	c := testContig("c", Marker{Name: "a", LG: "1", GenPos: 4, Weight: 90})
+	c.Placeable = false
+	c.CalculateRange()
+	if c.Range[0] != nil || c.Range[1] != nil {
+		t.Errorf("unplaceable contig: Range = %v, want it unset", c.Range)
+	}
+}
+
+// Contig ready for filterContigs, with its range and average weight set
+func rangeContig(name, lg string, from, to float64, weight uint64) *Contig {
+	c := NewContig()
+	c.Name, c.LG, c.AvgWeight, c.GenPos = name, lg, weight, from
+	c.Range = [2]*Marker{{GenPos: from, Weight: weight}, {GenPos: to, Weight: weight}}
+	return c
+}
+
+func TestFilterContigs(t *testing.T) {
+	tests := []struct {
+		name    string
+		contigs []*Contig
+		kept    []string
+	}{
+		{"unplaceable", []*Contig{func() *Contig { c := rangeContig("a", "1", 1, 2, 50); c.Placeable = false; return c }()}, nil},
+		{"other LG", []*Contig{rangeContig("a", "2", 1, 2, 50)}, nil},
+		{"no range", []*Contig{rangeContig("a", "1", 1, 1, 50), rangeContig("b", "1", 1, 1, 10)}, []string{"a", "b"}},
+		{"same start, same weight and end", []*Contig{rangeContig("a", "1", 1, 3, 50), rangeContig("b", "1", 1, 3, 50)}, nil},
+		{"same start, lower weight", []*Contig{rangeContig("a", "1", 1, 3, 50), rangeContig("b", "1", 1, 3, 40)}, []string{"a"}},
+		{"not contained", []*Contig{rangeContig("a", "1", 1, 3, 50), rangeContig("b", "1", 2, 4, 10)}, []string{"a", "b"}},
+		{"contained, lower weight", []*Contig{rangeContig("a", "1", 1, 5, 50), rangeContig("b", "1", 2, 4, 40)}, []string{"a"}},
+		{"contained, higher weight", []*Contig{rangeContig("a", "1", 1, 5, 50), rangeContig("b", "1", 2, 4, 60)}, []string{"b"}},
+		{"contained, same weight", []*Contig{rangeContig("a", "1", 1, 5, 50), rangeContig("b", "1", 2, 4, 50)}, nil},
+		{"contained, curated", []*Contig{rangeContig("a", "1", 1, 5, 50), func() *Contig { c := rangeContig("b", "1", 2, 4, 10); c.Curated = true; return c }()}, []string{"a", "b"}},
+	}
+	for _, tt := range tests {
+		CM := NewContigMap()
+		CM.Name = "1"
+		CM.AddContigs(tt.contigs...)
+		deleted := CM.filterContigs()
+		var kept []string
+		for name := range *CM.Contigs {
+			kept = append(kept, name)
+		}
+		sort.Strings(kept)
+		if !equalStrings(kept, tt.kept) {
+			t.Errorf("%s: kept %v, want %v", tt.name, kept, tt.kept)
+		}
+		if deleted != len(tt.contigs)-len(tt.kept) || CM.Deleted != deleted || !CM.Filtered {
+			t.Errorf("%s: deleted %d (Deleted %d, Filtered %v), want %d", tt.name, deleted, CM.Deleted, CM.Filtered, len(tt.contigs)-len(tt.kept))
+		}
+	}
+}
+
+// Header of a run with a single option
+func testHeader() *RunHeader {
+	return &RunHeader{Version: "1.0", Command: "place", Config: map[string]string{"out": "x"}}
+}
+
+// Two contigs of known length in LG 1 with a 100 bp gap between them
+func writerPlacements() []Placement {
+	return []Placement{
+		{LG: "1", Contig: "a", GenPos: 1, Orientation: "+", Weight: 90, Length: 50, Start: 0,
+			Gap: Gap{Before: "a", After: "b", Size: 100, Estimated: true}, Evidence: MapSource},
+		{LG: "1", Contig: "b", GenPos: 2.5, Length: 30, Start: 150},
+	}
+}
+
+func TestWriters(t *testing.T) {
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"map", "## ContigMapper 1.0 place\n## out = \"x\"\n### LG: 1\n### Deleted Sequences: 2\na\t1.000\t+\nb\t2.500\t\n\n"},
+		{"tsv", "## ContigMapper 1.0 place\n## out = \"x\"\nLG\tContig\tPosition\tOrientation\n1\ta\t1.000\t+\n1\tb\t2.500\t\n"},
+		{"agp", "##agp-version 2.0\n## ContigMapper 1.0 place\n## out = \"x\"\n1\t1\t50\t1\tW\ta\t1\t50\t+\n1\t51\t150\t2\tN\t100\tscaffold\tyes\tmap\n1\t151\t180\t3\tW\tb\t1\t30\t?\n"},
+		{"bed", "## ContigMapper 1.0 place\n## out = \"x\"\n1\t0\t50\ta\t0\t+\n1\t150\t180\tb\t0\t.\n"},
+		{"gff3", "##gff-version 3\n# ContigMapper 1.0 place\n# out = \"x\"\n##sequence-region 1 1 180\n" +
+			"1\tContigMapper\tcontig\t1\t50\t.\t+\t.\tID=a;Name=a;lg=1;cM=1.000;weight=90;orientation=+\n" +
+			"1\tContigMapper\tcontig\t151\t180\t.\t.\t.\tID=b;Name=b;lg=1;cM=2.500;weight=0;orientation=?\n"},
+	}
+	for _, tt := range tests {
+		var out strings.Builder
+		w, err := NewWriter(tt.format, &out, testHeader())
+		if err == nil {
+			err = w.WriteLG("1", 2, writerPlacements())
+		}
+		if err == nil {
+			err = w.Finish()
+		}
+		if err != nil || out.String() != tt.want {
+			t.Errorf("%s: wrote %q (%v), want %q", tt.format, out.String(), err, tt.want)
+		}
+	}
+	if _, err := NewWriter("xml", io.Discard, nil); err == nil {
+		t.Error("unknown format: no error")
+	}
+	for _, format := range []string{"agp", "bed", "gff3"} {
+		w, _ := NewWriter(format, io.Discard, nil)
+		if err := w.WriteLG("1", 0, []Placement{{Contig: "a"}}); err == nil {
+			t.Errorf("%s: no error for a contig of unknown length", format)
+		}
+	}
+}
+
+// The JSON writer writes what ReadResultJSON reads, with the lengths
+func TestJSONWriter(t *testing.T) {
+	var out strings.Builder
+	w, _ := NewWriter("json", &out, testHeader())
+	w.WriteLG("1", 2, writerPlacements())
+	w.WriteLG("2", 0, nil)
+	if err := w.Finish(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out.String(), "{\n  \"header\": {\n    \"version\": \"1.0\"") {
+		t.Errorf("no header in %q", out.String())
+	}
+	maps, names, err := ReadResultJSON(strings.NewReader(out.String()))
+	if err != nil {
+		t.Fatalf("%v in %q", err, out.String())
+	}
+	if !equalStrings(names, []string{"1", "2"}) || maps["1"].Deleted != 2 || len(*maps["2"].Contigs) != 0 {
+		t.Fatalf("read LGs %v from %q", names, out.String())
+	}
+	got := maps["1"].Placements(nil)
+	if len(got) != 2 || got[0].Contig != "a" || got[1].Contig != "b" || got[0].Length != 50 || got[1].GenPos != 2.5 || got[0].Orientation != "+" {
+		t.Errorf("read placements %+v", got)
+	}
+}
+
+// A LG found twice is an error in both result formats, and not a merge of its contigs
+func TestReadResultDuplicateLG(t *testing.T) {
+	text := "### LG: 1\na\t1\t+\n### LG: 2\nb\t1\t+\n### LG: 1\nc\t2\t-\n"
+	if _, _, err := ReadResult(strings.NewReader(text)); err == nil || err.Error() != "line 5: LG 1 found twice" {
+		t.Errorf("ReadResult: %v", err)
+	}
+	var out strings.Builder
+	w, _ := NewWriter("json", &out, nil)
+	w.WriteLG("1", 0, writerPlacements())
+	w.WriteLG("1", 0, nil)
+	if err := w.Finish(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ReadResultJSON(strings.NewReader(out.String())); err == nil || err.Error() != "LG 1 found twice" {
+		t.Errorf("ReadResultJSON: %v", err)
+	}
+}
+
+func TestReadAnyResultJSON(t *testing.T) {
+	// The kind of JSON is found after a header larger than any fixed peek
+	large := testHeader()
+	for i := 0; i < 200; i++ {
+		large.Notes = append(large.Notes, "curation: contig"+strconv.Itoa(i)+"\texclude")
+	}
+	for _, h := range []*RunHeader{nil, testHeader(), large} {
+		var result strings.Builder
+		w, _ := NewWriter("json", &result, h)
+		w.WriteLG("1", 0, writerPlacements())
+		if err := w.Finish(); err != nil {
+			t.Fatal(err)
+		}
+		maps, _, err := ReadResultJSON(strings.NewReader(result.String()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var model, lines strings.Builder
+		WriteModel(&model, maps, []string{"1"}, false, h)
+		WriteModel(&lines, maps, []string{"1"}, true, h)
+		for kind, in := range map[string]string{"result": result.String(), "model": model.String(), "jsonl": lines.String()} {
+			maps, names, err := ReadAnyResult(strings.NewReader(in))
+			if err != nil || !equalStrings(names, []string{"1"}) || len(*maps["1"].Contigs) != 2 {
+				t.Errorf("%s with a header of %d bytes: read LGs %v, %v", kind, len(h.Comment("")), names, err)
+			}
+		}
+	}
+	// A model without LGs is an error and not an empty result
+	header, _ := json.Marshal(map[string]*RunHeader{"header": large})
+	if _, _, err := ReadAnyResult(bytes.NewReader(header)); err == nil {
+		t.Error("no error for a model without LGs")
+	}
+}
+
+func TestWriteMarkerBED(t *testing.T) {
+	CM := NewContigMap()
+	CM.Name = "1"
+	a := rangeContig("a", "1", 1, 2, 50)
+	a.Length, a.Orientation = 100, "+"
+	a.AddMarkers(&Marker{Name: "m2", Contig: "a", LG: "1", ConPos: 60, GenPos: 2, Weight: 50}, &Marker{Name: "m1", Contig: "a", LG: "1", ConPos: 10, GenPos: 1, Weight: 2000},
+		&Marker{Name: "x", Contig: "a", LG: "2", ConPos: 20, GenPos: 7, Weight: 50})
+	b := rangeContig("b", "1", 3, 3, 50)
+	b.Length, b.Orientation = 40, "-"
+	b.AddMarkers(&Marker{Name: "m3", Contig: "b", LG: "1", ConPos: 9, GenPos: 3, Weight: 50})
+	CM.AddContigs(a, b)
+	CM.Filtered = true
+	var out strings.Builder
+	if err := CM.WriteMarkerBED(&out, []Gap{{Before: "a", After: "b", Size: 10}}); err != nil {
+		t.Fatal(err)
+	}
+	// b starts at 110 and is reversed, so its marker at 9 is at 110+40-1-9
+	want := "1\t10\t11\tm1:1.000\t1000\t+\n1\t60\t61\tm2:2.000\t50\t+\n1\t140\t141\tm3:3.000\t50\t-\n"
+	if out.String() != want {
+		t.Errorf("WriteMarkerBED wrote %q, want %q", out.String(), want)
+	}
+	b.AddMarkers(&Marker{Name: "m4", Contig: "b", LG: "1", ConPos: 40, GenPos: 3, Weight: 50})
+	if err := CM.WriteMarkerBED(io.Discard, nil); err == nil {
+		t.Error("no error for a marker outside its contig")
+	}
+}
+
+// The placements of writerPlacements with b reversed
+func liftPlacements() []Placement {
+	p := writerPlacements()
+	p[1].Orientation = "-"
+	return p
+}
+
+func TestLift(t *testing.T) {
+	l, err := NewLiftover(liftPlacements())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		contig     string
+		start, end uint64
+		s, e       uint64
+		reverse    bool
+		ok         bool
+	}{
+		{"forward", "a", 10, 20, 10, 20, false, true},
+		{"reversed", "b", 0, 10, 170, 180, true, true},
+		{"whole reversed contig", "b", 0, 30, 150, 180, true, true},
+		{"past the end", "a", 40, 60, 0, 0, false, false},
+		{"unknown contig", "c", 0, 1, 0, 0, false, false},
+	}
+	for _, tt := range tests {
+		_, s, e, reverse, ok := l.Lift(tt.contig, tt.start, tt.end)
+		if ok != tt.ok || ok && (s != tt.s || e != tt.e || reverse != tt.reverse) {
+			t.Errorf("%s: Lift = %d-%d reverse %v ok %v, want %d-%d reverse %v ok %v", tt.name, s, e, reverse, ok, tt.s, tt.e, tt.reverse, tt.ok)
+		}
+	}
+	// The AGP of the same placements gives the same liftover
+	var agp strings.Builder
+	w, _ := NewWriter("agp", &agp, nil)
+	w.WriteLG("1", 0, liftPlacements())
+	w.Finish()
+	fromAGP, err := ReadLiftoverAGP(strings.NewReader(agp.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var chain, chainAGP strings.Builder
+	l.WriteChain(&chain, nil)
+	fromAGP.WriteChain(&chainAGP, nil)
+	want := "chain 50 a 50 + 0 50 1 180 + 0 50 1\n50\n\nchain 30 b 30 + 0 30 1 180 - 0 30 2\n30\n\n"
+	if chain.String() != want || chainAGP.String() != want {
+		t.Errorf("WriteChain wrote %q and from the AGP %q, want %q", chain.String(), chainAGP.String(), want)
+	}
+}
+
+func TestLiftRecords(t *testing.T) {
+	l, _ := NewLiftover(liftPlacements())
+	tests := []struct {
+		name     string
+		run      func(io.Reader, io.Writer, io.Writer, *RunHeader) (LiftCounts, error)
+		in, want string
+		unlifted string
+	}{
+		{"bed", l.LiftBED, "track name=t\na\t10\t20\tx\t0\t+\nb\t0\t30\ty\t0\t+\t5\t25\t0\t2\t5,10,\t0,20,\nc\t0\t1\n",
+			"track name=t\n1\t10\t20\tx\t0\t+\n1\t150\t180\ty\t0\t-\t155\t175\t0\t2\t10,5,\t0,25,\n", "#not in a placed contig\nc\t0\t1\n"},
+		{"gff3", l.LiftGFF, "##gff-version 3\n##sequence-region b 1 30\nb\tx\tgene\t1\t10\t.\t+\t.\tID=g\n##FASTA\n>b\nAC\n",
+			"##gff-version 3\n##sequence-region 1 1 180\n1\tx\tgene\t171\t180\t.\t-\t.\tID=g\n", ""},
+		{"vcf", l.LiftVCF, "##contig=<ID=b,length=30>\n#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO\n" +
+			"a\t3\t.\tAC\tA\t.\t.\tEND=4\nb\t1\t.\tAC\tGT,TT\t.\t.\t.\nb\t5\t.\tA\tAT\t.\t.\t.\n",
+			"##contig=<ID=1,length=180>\n#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO\n1\t3\t.\tAC\tA\t.\t.\tEND=4\n1\t179\t.\tGT\tAC,AA\t.\t.\t.\n",
+			"#cannot be reverse complemented\nb\t5\t.\tA\tAT\t.\t.\t.\n"},
+	}
+	for _, tt := range tests {
+		var out, unlifted strings.Builder
+		if _, err := tt.run(strings.NewReader(tt.in), &out, &unlifted, nil); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != tt.want || unlifted.String() != tt.unlifted {
+			t.Errorf("%s: wrote %q and unlifted %q, want %q and %q", tt.name, out.String(), unlifted.String(), tt.want, tt.unlifted)
+		}
+	}
+}
+
+// The model written and read again keeps the computed fields, the range and the markers shared between the map and the contigs
+func TestModel(t *testing.T) {
+	CM := NewContigMap()
+	CM.Name = "1"
+	a := rangeContig("a", "1", 1, 5, 50)
+	a.Placeable, a.Length, a.Orientation, a.OrientSource = true, 100, "+", "markers"
+	m1 := &Marker{Name: "m1", Contig: "a", LG: "1", ConPos: 10, GenPos: 1, Weight: 50}
+	m2 := &Marker{Name: "m2", Contig: "a", LG: "2", ConPos: 20, GenPos: 8, Weight: 5}
+	a.AddMarkers(m1, m2)
+	a.Range[0] = m1
+	b := rangeContig("b", "1", 2, 4, 40)
+	b.Placeable = true
+	CM.AddContigs(a, b)
+	CM.AddMarkers(m1)
+	CM.Adjacencies = []Adjacency{{"a", "b", "hic"}}
+	for _, lines := range []bool{false, true} {
+		var first strings.Builder
+		if err := WriteModel(&first, map[string]*ContigMap{"1": CM}, []string{"1"}, lines, testHeader()); err != nil {
+			t.Fatal(err)
+		}
+		maps, names, err := ReadModel(strings.NewReader(first.String()))
+		if err != nil {
+			t.Fatalf("lines %v: %v\n%s", lines, err, first.String())
+		}
+		var second strings.Builder
+		WriteModel(&second, maps, names, lines, testHeader())
+		if second.String() != first.String() {
+			t.Errorf("lines %v: model changes when written again:\n%s\n%s", lines, first.String(), second.String())
+		}
+		r := maps["1"]
+		ra := (*r.Contigs)["a"]
+		if ra.Range[0] != (*ra.Markers)["m1"] || (*r.Markers)["m1"] != ra.Range[0] || ra.Range[1].GenPos != 5 || ra.OrientSource != "markers" || ra.Length != 100 {
+			t.Errorf("lines %v: contig read as %v", lines, ra)
+		}
+		if len(r.Adjacencies) != 1 || r.Adjacencies[0].Source != "hic" || r.Filtered {
+			t.Errorf("lines %v: map read with adjacencies %v, filtered %v", lines, r.Adjacencies, r.Filtered)
+		}
+		// b is inside the range of a with a lower weight
+		if r.Filter() != 1 || len(*r.Contigs) != 1 {
+			t.Errorf("lines %v: the reloaded map filters %d contigs, want 1", lines, r.Deleted)
+		}
+	}
+	if _, _, err := ReadModel(strings.NewReader(`{"version": 9, "maps": []}`)); err == nil {
+		t.Error("newer model version: no error")
+	}
+}
+
+// The snapshot keeps the contigs that are not in any map, and a model is not a snapshot
+func TestSnapshot(t *testing.T) {
+	CM := NewContigMap()
+	CM.Name = "1"
+	a := rangeContig("a", "1", 1, 5, 50)
+	a.Placeable = true
+	CM.AddContigs(a)
+	u := NewContig()
+	u.Name, u.LG, u.Reason = "u", "-", ReasonConflictingLG
+	u.AddMarkers(&Marker{Name: "m1", Contig: "u", LG: "1", GenPos: 1, Weight: 5}, &Marker{Name: "m2", Contig: "u", LG: "2", GenPos: 9, Weight: 5})
+	var snapshot strings.Builder
+	if err := WriteSnapshot(&snapshot, map[string]*ContigMap{"1": CM}, []string{"1"}, map[string]*Contig{"a": a, "u": u}, testHeader()); err != nil {
+		t.Fatal(err)
+	}
+	maps, names, contigs, err := ReadSnapshot(strings.NewReader(snapshot.String()))
+	if err != nil {
+		t.Fatalf("%v\n%s", err, snapshot.String())
+	}
+	if len(names) != 1 || len(contigs) != 2 || contigs["a"] != (*maps["1"].Contigs)["a"] || contigs["u"].Reason != ReasonConflictingLG || len(*contigs["u"].Markers) != 2 {
+		t.Errorf("snapshot read as %v and contigs %v", maps, contigs)
+	}
+	var model strings.Builder
+	WriteModel(&model, maps, names, false, nil)
+	if _, _, _, err := ReadSnapshot(strings.NewReader(model.String())); err == nil {
+		t.Error("model read as a snapshot")
+	}
+	if _, _, err := ReadModel(strings.NewReader(snapshot.String())); err != nil {
+		t.Errorf("snapshot not read as a model: %v", err)
+	}
+}
+
+func TestReadOverrides(t *testing.T) {
+	in := "# curation\na\tforce-LG\t2\n\nb\tforce-LG\t1\t2.5\nc\tforce-orientation\t-\nd\texclude\ne\tpin-after\ta\nf\tsplit-at\t100\n"
+	overrides, err := ReadOverrides(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, o := range overrides {
+		got = append(got, o.String())
+	}
+	want := []string{"a force-LG 2", "b force-LG 1 2.500", "c force-orientation -", "d exclude", "e pin-after a", "f split-at 100"}
+	if !equalStrings(got, want) || overrides[1].Line != 4 {
+		t.Errorf("read %v, want %v", got, want)
+	}
+	for _, in := range []string{"a\tflip", "a\texclude\tb", "a\tforce-LG", "a\tforce-LG\t1\tx", "a\tforce-orientation\t?",
+		"a\tsplit-at\t0", "a\tsplit-at\t-5", "a\tpin-before\ta", "\tforce-orientation\t+"} {
+		if _, err := ReadOverrides(strings.NewReader(in)); err == nil {
+			t.Errorf("%q: no error", in)
+		}
+	}
+}
+
+// Maps with the contigs a, b and c in LG 1 and d in LG 2, completed from their markers
+func curationMaps() (map[string]*ContigMap, map[string]*Contig) {
+	contigs := map[string]*Contig{
+		"a": testContig("a", Marker{Name: "m1", LG: "1", ConPos: 10, GenPos: 1, Weight: 50}, Marker{Name: "m2", LG: "1", ConPos: 500, GenPos: 2, Weight: 50}),
+		"b": testContig("b", Marker{Name: "m3", LG: "1", ConPos: 10, GenPos: 3, Weight: 50}, Marker{Name: "m4", LG: "1", ConPos: 500, GenPos: 4, Weight: 50}),
+		"c": testContig("c", Marker{Name: "m5", LG: "1", ConPos: 10, GenPos: 5, Weight: 50}, Marker{Name: "m6", LG: "2", ConPos: 500, GenPos: 8, Weight: 10}),
+		"d": testContig("d", Marker{Name: "m7", LG: "2", ConPos: 10, GenPos: 7, Weight: 50}),
+	}
+	maps := map[string]*ContigMap{"1": NewContigMap(), "2": NewContigMap()}
+	for name, CM := range maps {
+		CM.Name = name
+	}
+	for _, c := range contigs {
+		c.Length = 1000
+		c.Autocomplete()
+		maps[c.LG].AddContigs(c)
+	}
+	return maps, contigs
+}
+
+// Names of the ordered contigs of the map
+func orderedNames(CM *ContigMap) (out []string) {
+	for _, c := range CM.Ordered() {
+		out = append(out, c.Name)
+	}
+	return out
+}
+
+func TestApplyOverrides(t *testing.T) {
+	tests := []struct {
+		name      string
+		overrides string
+		lg1, lg2  []string
+	}{
+		{"exclude", "b\texclude", []string{"a", "c"}, []string{"d"}},
+		{"force-LG with markers", "c\tforce-LG\t2", []string{"a", "b"}, []string{"d", "c"}},
+		{"force-LG at a position", "a\tforce-LG\t2\t9", []string{"b", "c"}, []string{"d", "a"}},
+		{"pin-after", "a\tpin-after\tb", []string{"b", "a", "c"}, []string{"d"}},
+		{"pin-before in another LG", "d\tpin-before\tb", []string{"a", "d", "b", "c"}, nil},
+		{"split-at", "c\tsplit-at\t200", []string{"a", "b", "c_1"}, []string{"d", "c_2"}},
+	}
+	for _, tt := range tests {
+		maps, contigs := curationMaps()
+		overrides, err := ReadOverrides(strings.NewReader(tt.overrides))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		log, err := ApplyOverrides(maps, contigs, overrides)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if len(log) != 1 {
+			t.Errorf("%s: log %v", tt.name, log)
+		}
+		if lg1, lg2 := orderedNames(maps["1"]), orderedNames(maps["2"]); !equalStrings(lg1, tt.lg1) || !equalStrings(lg2, tt.lg2) {
+			t.Errorf("%s: ordered %v and %v, want %v and %v", tt.name, lg1, lg2, tt.lg1, tt.lg2)
+		}
+	}
+
+	maps, contigs := curationMaps()
+	overrides, _ := ReadOverrides(strings.NewReader("b\texclude\na\tforce-orientation\t-\nc\tsplit-at\t200"))
+	if _, err := ApplyOverrides(maps, contigs, overrides); err != nil {
+		t.Fatal(err)
+	}
+	if b := contigs["b"]; b.Placeable || b.Reason != ReasonExcluded {
+		t.Errorf("excluded contig: Placeable %v, Reason %q", b.Placeable, b.Reason)
+	}
+	if a := contigs["a"]; a.Orientation != "-" || a.OrientSource != CurationSource || !a.Curated {
+		t.Errorf("oriented contig: Orientation %q from %q", a.Orientation, a.OrientSource)
+	}
+	c1, c2 := contigs["c_1"], contigs["c_2"]
+	if _, ok := contigs["c"]; ok || c1 == nil || c2 == nil || c1.Length != 200 || c2.Length != 800 || (*c2.Markers)["m6"].ConPos != 300 {
+		t.Errorf("split contig: parts %v and %v", c1, c2)
+	}
+
+	for _, in := range []string{"x\texclude", "a\tforce-LG\t3", "a\tpin-after\tx", "d\tforce-LG\t1", "a\tsplit-at\t1000"} {
+		maps, contigs := curationMaps()
+		overrides, _ := ReadOverrides(strings.NewReader(in))
+		if _, err := ApplyOverrides(maps, contigs, overrides); err == nil {
+			t.Errorf("%q: no error", in)
+		}
+	}
+}
+
+func TestEstimateGaps(t *testing.T) {
+	// a and c at 1 cM/Mb, b at 2 cM/Mb and d far away with a single marker
+	CM := NewContigMap()
+	CM.Name = "1"
+	for _, c := range []*Contig{
+		testContig("a", Marker{Name: "a1", LG: "1", ConPos: 0, GenPos: 0, Weight: 10}, Marker{Name: "a2", LG: "1", ConPos: 1e6, GenPos: 1, Weight: 10}),
+		testContig("b", Marker{Name: "b1", LG: "1", ConPos: 0, GenPos: 2, Weight: 10}, Marker{Name: "b2", LG: "1", ConPos: 5e5, GenPos: 3, Weight: 10}),
+		testContig("c", Marker{Name: "c1", LG: "1", ConPos: 0, GenPos: 4, Weight: 10}, Marker{Name: "c2", LG: "1", ConPos: 1e6, GenPos: 5, Weight: 10}),
+		testContig("d", Marker{Name: "d1", LG: "1", ConPos: 0, GenPos: 100, Weight: 10}),
+	} {
+		c.Autocomplete()
+		CM.AddContigs(c)
+	}
+	tests := []struct {
+		name   string
+		window float64
+		sizes  []uint64
+	}{
+		{"LG rate", 0, []uint64{833333, 833333, UnknownGap}},
+		{"window without contigs", 1, []uint64{833333, 833333, UnknownGap}},
+		{"window", 2.2, []uint64{750000, 750000, UnknownGap}},
+	}
+	for _, tt := range tests {
+		gaps := CM.EstimateGaps(tt.window)
+		var sizes []uint64
+		for _, g := range gaps {
+			sizes = append(sizes, g.Size)
+			if g.Estimated != (g.Size != UnknownGap) {
+				t.Errorf("%s: gap %v", tt.name, g)
+			}
+		}
+		if len(sizes) != len(tt.sizes) || sizes[0] != tt.sizes[0] || sizes[1] != tt.sizes[1] || sizes[2] != tt.sizes[2] {
+			t.Errorf("%s: gaps %v, want %v", tt.name, sizes, tt.sizes)
+		}
+	}
+	if r := CM.RecombinationRate(0, 0); math.Abs(r-1.2) > 1e-9 {
+		t.Errorf("LG rate %v, want 1.2", r)
+	}
+}
+
+func TestWriteFasta(t *testing.T) {
+	CM := NewContigMap()
+	CM.Name = "1"
+	a, b := rangeContig("a", "1", 1, 2, 50), rangeContig("b", "1", 3, 4, 50)
+	a.Placeable, b.Placeable, a.Orientation, b.Orientation = true, true, "+", "-"
+	CM.AddContigs(a, b)
+	in := ">a\nACG\nTA\n>b\nAAC\nC\n"
+	index, err := IndexFasta(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	seqs := NewFasta(strings.NewReader(in), index)
+	var out strings.Builder
+	if err := CM.WriteFasta(&out, seqs, []Gap{{Before: "a", After: "b", Size: 3, Estimated: true}}, 4); err != nil {
+		t.Fatal(err)
+	}
+	if want := ">1\nACGT\nANNN\nGGTT\n"; out.String() != want {
+		t.Errorf("wrote %q, want %q", out.String(), want)
+	}
+	delete(seqs.Index, "b")
+	if err := CM.WriteFasta(io.Discard, seqs, nil, 4); err == nil {
+		t.Error("no error for a contig without sequence")
+	}
+}
+
+func TestIndexFasta(t *testing.T) {
+	in := ">a desc\nACGT\nAC\n>b\r\nGGC\r\nTA\r\n\n>c\n>d\nACGTT"
+	index, err := IndexFasta(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]FaiEntry{"a": {6, 8, 4, 5}, "b": {5, 20, 3, 5}, "c": {0, 33, 0, 0}, "d": {5, 36, 5, 5}}
+	for name, e := range want {
+		if index[name] != e {
+			t.Errorf("%s: index %v, want %v", name, index[name], e)
+		}
+	}
+	var fai strings.Builder
+	for _, name := range []string{"a", "b", "c", "d"} {
+		e := index[name]
+		fai.WriteString(name + "\t" + strconv.FormatUint(e.Length, 10) + "\t" + strconv.FormatUint(e.Offset, 10) + "\t" +
+			strconv.FormatUint(e.LineBases, 10) + "\t" + strconv.FormatUint(e.LineWidth, 10) + "\n")
+	}
+	if read, err := ReadFai(strings.NewReader(fai.String())); err != nil || len(read) != 4 || read["b"] != want["b"] {
+		t.Errorf("fai read as %v, %v", read, err)
+	}
+	// Small chunks to read the sequences in several pieces
+	defer func(chunk uint64) { fastaChunk = chunk }(fastaChunk)
+	fastaChunk = 2
+	seqs := NewFasta(strings.NewReader(in), index)
+	for _, tt := range []struct {
+		name    string
+		reverse bool
+		want    string
+	}{{"a", false, "ACGTAC"}, {"a", true, "GTACGT"}, {"b", false, "GGCTA"}, {"b", true, "TAGCC"}, {"c", true, ""}, {"d", true, "AACGT"}} {
+		var out strings.Builder
+		if err := seqs.copySequence(&out, tt.name, tt.reverse); err != nil || out.String() != tt.want {
+			t.Errorf("%s reverse %v: copied %q, %v, want %q", tt.name, tt.reverse, out.String(), err, tt.want)
+		}
+	}
+	for _, in := range []string{"ACGT\n>a\nAC\n", ">a\nAC\n>a\nGG\n", ">\nAC\n", ">a\nAC\nACG\n", ">a\nACG\nA\nACG\n", ">a\nAC\n\nAC\n", ">a\nA C\n"} {
+		if _, err := IndexFasta(strings.NewReader(in)); err == nil {
+			t.Errorf("%q: no error", in)
+		}
+	}
+	stale := NewFasta(strings.NewReader(">a\nAC\n"), map[string]FaiEntry{"a": {4, 3, 2, 3}})
+	if err := stale.copySequence(io.Discard, "a", false); err == nil {
+		t.Error("no error for an index that does not match the fasta")
+	}
+}
+
+func TestRunHeader(t *testing.T) {
+	h := testHeader()
+	h.Config["pseudo"] = "a--b.fa"
+	h.Notes = []string{"curation: a exclude: excluded"}
+	if got, want := h.Comment("##"), "## ContigMapper 1.0 place\n## out = \"x\"\n## pseudo = \"a--b.fa\"\n## curation: a exclude: excluded\n"; got != want {
+		t.Errorf("comment %q, want %q", got, want)
+	}
+	if got := h.xml(); strings.Contains(got[4:len(got)-4], "--") {
+		t.Errorf("\"--\" inside the XML comment %q", got)
+	}
+	if got, want := h.vcf(), "##ContigMapper_placeVersion=1.0\n##ContigMapper_placeCommand=-out=\"x\" -pseudo=\"a--b.fa\"\n"+
+		"##ContigMapper_placeNote=curation: a exclude: excluded\n"; got != want {
+		t.Errorf("VCF header %q, want %q", got, want)
+	}
+	var nilHeader *RunHeader
+	if nilHeader.Comment("#") != "" || nilHeader.vcf() != "" || nilHeader.xml() != "" {
+		t.Error("nil header written")
+	}
+	// The header goes after the version line of GFF3 and VCF and first in BED
+	l, _ := NewLiftover(liftPlacements())
+	for _, tt := range []struct {
+		run      func(io.Reader, io.Writer, io.Writer, *RunHeader) (LiftCounts, error)
+		in, want string
+	}{
+		{l.LiftBED, "a\t10\t20\n", "## ContigMapper 1.0 place\n"},
+		{l.LiftGFF, "##gff-version 3\n", "##gff-version 3\n##sequence-region 1 1 180\n# ContigMapper 1.0 place\n"},
+		{l.LiftGFF, "", "# ContigMapper 1.0 place\n"},
+		{l.LiftVCF, "##fileformat=VCFv4.2\n", "##fileformat=VCFv4.2\n##ContigMapper_placeVersion=1.0\n"},
+	} {
+		var out, unlifted strings.Builder
+		if _, err := tt.run(strings.NewReader(tt.in), &out, &unlifted, testHeader()); err != nil || !strings.HasPrefix(out.String(), tt.want) {
+			t.Errorf("%q lifted to %q, %v, want it to start with %q", tt.in, out.String(), err, tt.want)
+		}
+		if !strings.Contains(unlifted.String(), "ContigMapper") {
+			t.Errorf("%q: no header in the unlifted output %q", tt.in, unlifted.String())
+		}
+	}
+}
+
+// Placement result in the format of WriteMap, with one "contig position [orientation]" per line. The contigs keep the
+// order of the text in their bins and their Range is their genetic position
+func testResult(t *testing.T, text string) (map[string]*ContigMap, []string) {
+	t.Helper()
+	maps := make(map[string]*ContigMap)
+	var names []string
+	var CM *ContigMap
+	for _, l := range strings.Split(text, "\n") {
+		if strings.HasPrefix(l, "### LG: ") {
+			CM = NewContigMap()
+			CM.Name = strings.TrimPrefix(l, "### LG: ")
+			CM.Filtered = true
+			maps[CM.Name] = CM
+			names = append(names, CM.Name)
+			continue
+		}
+		fields := append(strings.Fields(l), "")
+		pos, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := NewContig()
+		c.Name, c.LG, c.GenPos, c.Orientation, c.BinRank = fields[0], CM.Name, pos, fields[2], len(*CM.Contigs)
+		p := Marker{GenPos: pos}
+		c.Range = [2]*Marker{&p, &p}
+		CM.AddContigs(c)
+	}
+	return maps, names
+}
+
+func TestOrderBins(t *testing.T) {
+	ref := &RefEvidence{map[string]*Alignment{"b": {Target: "chr1", Start: 300}, "c": {Target: "chr1", Start: 100}, "d": {Target: "chr1", Start: 200}}}
+	links := NewLinkEvidence("hic")
+	links.Add("b", "c", 5)
+	links.Add("f", "e", 3)
+	links.Add("g", "x", 3)
+	tests := []struct {
+		name     string
+		evidence []Evidence
+		want     []string
+	}{
+		{"no evidence", nil, []string{"a b map", "b c none", "c d none", "d f map", "f e none", "e g map", "g h none"}},
+		{"reference then links", []Evidence{ref, links}, []string{"a c map", "c d reference", "d b reference", "b e map", "e f hic", "f g map", "g h none"}},
+		// d has no links with b or c, so the reference orders their bin
+		{"links then reference", []Evidence{links, ref}, []string{"a c map", "c d reference", "d b reference", "b e map", "e f hic", "f g map", "g h none"}},
+	}
+	for _, tt := range tests {
+		maps, _ := testResult(t, `### LG: 1
+a 1
+b 2
+c 2
+d 2
+f 3
+e 3
+g 4
+h 4`)
+		var got []string
+		for _, a := range maps["1"].OrderBins(tt.evidence...) {
+			got = append(got, a.Before+" "+a.After+" "+a.Source)
+		}
+		if strings.Join(got, ", ") != strings.Join(tt.want, ", ") {
+			t.Errorf("%s: adjacencies %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestOrientHiC(t *testing.T) {
+	maps, _ := testResult(t, `### LG: 1
+a 1
+b 2 +
+c 3
+d 4 -
+e 5`)
+	h := NewHiC(nil)
+	h.Add("a", End, "b", Start, 10)
+	h.Add("c", End, "b", End, 6)
+	h.Add("d", Start, "c", Start, 2)
+	if n := h.Links().Count("b", "a"); n != 10 {
+		t.Errorf("links between a and b %v, want 10", n)
+	}
+	out := maps["1"].OrientHiC(h)
+	if len(out) != 1 || out[0] != (OrientConflict{"d", "-", "+"}) {
+		t.Errorf("conflicts %v, want d - in the map and + with Hi-C", out)
+	}
+	for _, tt := range []struct{ name, orientation, source string }{{"a", "+", "hic"}, {"b", "+", ""}, {"c", "-", "hic"}, {"d", "-", ""}, {"e", "", ""}} {
+		c := (*maps["1"].Contigs)[tt.name]
+		if c.Orientation != tt.orientation || c.OrientSource != tt.source {
+			t.Errorf("%s oriented %q by %q, want %q by %q", tt.name, c.Orientation, c.OrientSource, tt.orientation, tt.source)
+		}
+	}
+}
+
+// Anchors of a reference sequence at the given genetic positions, one every 100 bp
+func testAnchors(pos ...float64) (out []anchor) {
+	for i, p := range pos {
+		out = append(out, anchor{&Contig{GenPos: p}, &Alignment{Start: uint64(i+1) * 100}})
+	}
+	return out
+}
+
+func TestDirection(t *testing.T) {
+	tests := []struct {
+		name      string
+		anchors   []anchor
+		direction int
+		collinear []bool
+	}{
+		{"forward", testAnchors(1, 2, 2, 3), 1, []bool{true, true, true}},
+		{"reversed", testAnchors(3, 2, 1), -1, []bool{true, true}},
+		{"forward with a swap", testAnchors(1, 3, 2, 4), 1, []bool{true, false, true}},
+		{"reversed with a swap", testAnchors(4, 2, 3, 1), -1, []bool{true, false, true}},
+	}
+	for _, tt := range tests {
+		if d := direction(tt.anchors); d != tt.direction {
+			t.Errorf("%s: direction %d, want %d", tt.name, d, tt.direction)
+		}
+		for i, want := range tt.collinear {
+			if got := collinear(tt.anchors, i); got != want {
+				t.Errorf("%s: anchors %d and %d collinear %v, want %v", tt.name, i, i+1, got, want)
+			}
+		}
+	}
+}
+
+func TestPlaceByReference(t *testing.T) {
+	// LG 1 follows chr1, LG 2 runs against chr2 and LG 3 has b3 and c3 swapped on chr3
+	maps, _ := testResult(t, `### LG: 1
+a1 0 +
+b1 1 +
+### LG: 2
+a2 1 +
+b2 2 +
+c2 3 +
+### LG: 3
+a3 1 +
+b3 3 +
+c3 2 +
+d3 4 +`)
+	markerContigs := make(map[string]*Contig)
+	for _, CM := range maps {
+		for name, c := range *CM.Contigs {
+			markerContigs[name] = c
+		}
+	}
+	alignments := make(map[string]*Alignment)
+	align := func(name, target string, start uint64, strand string) {
+		alignments[name] = &Alignment{Query: name, QueryLen: 1000, Target: target, Start: start, End: start + 1000, Strand: strand}
+	}
+	for _, a := range []struct {
+		name, target string
+		start        uint64
+	}{{"a1", "chr1", 0}, {"b1", "chr1", 3000}, {"a2", "chr2", 500}, {"b2", "chr2", 300}, {"c2", "chr2", 100},
+		{"a3", "chr3", 100}, {"b3", "chr3", 200}, {"c3", "chr3", 300}, {"d3", "chr3", 400}} {
+		align(a.name, a.target, a.start, "+")
+	}
+	align("x", "chr1", 1000, "+") // a third of the way from a1 to b1
+	align("y", "chr2", 400, "+")  // between b2 and a2, on the reversed LG
+	align("z", "chr3", 250, "+")  // between b3 and c3, which are not collinear
+	align("w", "chr3", 350, "-")  // between c3 and d3
+	align("v", "chr1", 5000, "+") // after the last anchor
+	align("u", "chrUn", 100, "+") // on a sequence without LG
+	// Contigs with markers are left to the map even when they are not in any LG
+	markerContigs["m"] = NewContig()
+	align("m", "chr1", 1500, "+")
+	tests := []struct {
+		name, lg, orientation string
+		pos                   float64
+	}{
+		{"w", "3", "-", 3},
+		{"x", "1", "+", 0.333},
+		{"y", "2", "-", 1.5},
+	}
+	out := PlaceByReference(maps, alignments, markerContigs)
+	if len(out) != len(tests) {
+		t.Fatalf("%d contigs placed, want %d", len(out), len(tests))
+	}
+	for i, tt := range tests {
+		c := out[i]
+		if c.Name != tt.name || c.LG != tt.lg || c.GenPos != tt.pos || c.Orientation != tt.orientation || !c.RefPlaced {
+			t.Errorf("placed %s in LG %s at %v %s, want %s in LG %s at %v %s", c.Name, c.LG, c.GenPos, c.Orientation, tt.name, tt.lg, tt.pos, tt.orientation)
+		}
+		if (*maps[tt.lg].Contigs)[tt.name] != c {
+			t.Errorf("%s not added to LG %s", tt.name, tt.lg)
+		}
+	}
+}
+
+func TestOpen(t *testing.T) {
+	dir := t.TempDir()
+	text := "group 1\nm1\t1.0\n"
+	gz := func(parts ...string) []byte {
+		var b bytes.Buffer
+		// bgzip writes several gzip members, which are read as one stream
+		for _, p := range parts {
+			z := gzip.NewWriter(&b)
+			z.Write([]byte(p))
+			z.Close()
+		}
+		return b.Bytes()
+	}
+	files := map[string][]byte{
+		"plain.map":    []byte(text),
+		"gzip.map.txt": gz(text),
+		"bgzip.map":    gz(text[:8], text[8:]),
+		"short.map":    []byte("g"),
+		"empty.map":    nil,
+	}
+	if _, err := exec.LookPath("zstd"); err == nil {
+		cmd := exec.Command("zstd", "-c")
+		cmd.Stdin = strings.NewReader(text)
+		out, err := cmd.Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files["zstd.map"] = out
+	}
+	for name, data := range files {
+		file := filepath.Join(dir, name)
+		if err := os.WriteFile(file, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		want := text
+		switch name {
+		case "short.map", "empty.map":
+			want = string(data)
+		}
+		f, err := Open(file)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		got, err := io.ReadAll(f)
+		if e := f.Close(); err == nil {
+			err = e
+		}
+		if err != nil || string(got) != want {
+			t.Errorf("%s: read %q, %v, want %q", name, got, err, want)
+		}
+		if err := CheckDecompressor(data); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	// A truncated gzip input is an error
+	file := filepath.Join(dir, "truncated.gz")
+	os.WriteFile(file, gz(text)[:20], 0644)
+	if f, err := Open(file); err == nil {
+		_, err = io.ReadAll(f)
+		f.Close()
+		if err == nil {
+			t.Error("no error for a truncated gzip input")
+		}
+	}
+	// Outputs ending in .gz are compressed
+	file = filepath.Join(dir, "out.txt.gz")
+	w, err := Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(w, text)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(file); !bytes.HasPrefix(data, gzipMagic) {
+		t.Errorf("%s is not gzip compressed", file)
+	}
+}
+
+// LG 1 with contig a at 1-2 cM, where m3 has a low weight and is 2 cM off, and contig b at 3-3.5 cM without length
+func plotMap() *ContigMap {
+	CM := NewContigMap()
+	CM.Name = "1"
+	contig := func(name string, length uint64, markers ...Marker) {
+		c := NewContig()
+		c.Name, c.Length = name, length
+		for i := range markers {
+			m := markers[i]
+			m.Contig = name
+			c.AddMarkers(&m)
+			if m.LG == CM.Name {
+				CM.AddMarkers(&m)
+			}
+		}
+		c.Autocomplete()
+		CM.AddContigs(c)
+	}
+	contig("a", 1000, Marker{Name: "m1", LG: "1", ConPos: 10, GenPos: 1, Weight: 50}, Marker{Name: "m2", LG: "1", ConPos: 500, GenPos: 2, Weight: 50},
+		Marker{Name: "m3", LG: "1", ConPos: 250, GenPos: 4, Weight: 1}, Marker{Name: "m6", LG: "2", ConPos: 600, GenPos: 8, Weight: 10})
+	contig("b", 0, Marker{Name: "m4", LG: "1", ConPos: 10, GenPos: 3, Weight: 50}, Marker{Name: "m5", LG: "1", ConPos: 500, GenPos: 3.5, Weight: 50})
+	return CM
+}
+
+// Contig spanning the given genetic positions
+func spanContig(name string, from, to float64) *Contig {
+	c := NewContig()
+	c.Name = name
+	c.Range = [2]*Marker{{GenPos: from}, {GenPos: to}}
+	return c
+}
+
+func TestIsOutlier(t *testing.T) {
+	c := spanContig("a", 1, 3)
+	tests := []struct {
+		pos, tolerance float64
+		outlier        bool
+	}{
+		{2, 0, false},
+		{1, 0, false},
+		{3, 0, false},
+		{0.5, 0, true},
+		{0.5, 0.5, false},
+		{4, 0.5, true},
+		{4, 1, false},
+	}
+	for _, tt := range tests {
+		if got := c.IsOutlier(&Marker{GenPos: tt.pos}, tt.tolerance); got != tt.outlier {
+			t.Errorf("marker at %v with tolerance %v: outlier %v, want %v", tt.pos, tt.tolerance, got, tt.outlier)
+		}
+	}
+}
+
+func TestLayout(t *testing.T) {
+	tests := []struct {
+		name   string
+		gaps   []Gap
+		startB uint64
+		total  uint64
+	}{
+		// b has no length, so it ends after its last marker at 500
+		{"unknown gaps", nil, 1000 + UnknownGap, 1000 + UnknownGap + 501},
+		{"estimated gap", []Gap{{Before: "a", After: "b", Size: 10}}, 1010, 1511},
+	}
+	for _, tt := range tests {
+		starts, total := plotMap().Layout(tt.gaps)
+		if starts["a"] != 0 || starts["b"] != tt.startB || total != tt.total {
+			t.Errorf("%s: starts %v and total %d, want b at %d and total %d", tt.name, starts, total, tt.startB, tt.total)
+		}
+	}
+}
+
+func TestWriteMarey(t *testing.T) {
+	tests := []struct {
+		tolerance float64
+		outliers  int
+	}{
+		{0, 1},
+		{1.5, 1},
+		{2.5, 0},
+	}
+	for _, tt := range tests {
+		var out strings.Builder
+		if err := plotMap().WriteMarey(&out, nil, tt.tolerance, testHeader()); err != nil {
+			t.Fatal(err)
+		}
+		svg := out.String()
+		// Every marker of the LG is drawn once, and the marker of LG 2 is not
+		if n := strings.Count(svg, "<circle"); n != 5 {
+			t.Errorf("tolerance %v: %d markers drawn, want 5", tt.tolerance, n)
+		}
+		if n := strings.Count(svg, "<title>outlier "); n != tt.outliers {
+			t.Errorf("tolerance %v: %d outliers, want %d", tt.tolerance, n, tt.outliers)
+		}
+		if tt.outliers > 0 && !strings.Contains(svg, "<title>outlier m3 "+FormatPos(4)+"</title>") {
+			t.Errorf("tolerance %v: m3 is not the outlier in %s", tt.tolerance, svg)
+		}
+		if !strings.HasPrefix(svg, "<svg ") || !strings.HasSuffix(svg, "</svg>\n") || !strings.Contains(svg, "<!--") {
+			t.Errorf("tolerance %v: no SVG with the header in %s", tt.tolerance, svg)
+		}
+	}
+}
+
+func TestLanes(t *testing.T) {
+	// 13 contigs all overlapping the first, one more than the lanes
+	var crowded []*Contig
+	want := []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 0}
+	for i := range want {
+		crowded = append(crowded, spanContig(strconv.Itoa(i), 1, float64(2+i)))
+	}
+	tests := []struct {
+		name      string
+		contigs   []*Contig
+		minHeight float64
+		lanes     []int
+		n         int
+	}{
+		{"none", nil, 0, nil, 0},
+		{"apart", []*Contig{spanContig("a", 1, 2), spanContig("b", 3, 4)}, 0, []int{0, 0}, 1},
+		{"touching", []*Contig{spanContig("a", 1, 2), spanContig("b", 2, 3)}, 0, []int{0, 1}, 2},
+		{"overlapping", []*Contig{spanContig("a", 1, 3), spanContig("b", 2, 4), spanContig("c", 5, 6)}, 0, []int{0, 1, 0}, 2},
+		{"points", []*Contig{spanContig("a", 1, 1), spanContig("b", 1.5, 1.5)}, 0, []int{0, 0}, 1},
+		{"points with a minimum height", []*Contig{spanContig("a", 1, 1), spanContig("b", 1.5, 1.5)}, 1, []int{0, 1}, 2},
+		{"more than the lanes", crowded, 0, want, maxLanes},
+	}
+	for _, tt := range tests {
+		got, n := lanes(tt.contigs, tt.minHeight)
+		same := len(got) == len(tt.lanes) && n == tt.n
+		for i := 0; same && i < len(got); i++ {
+			same = got[i] == tt.lanes[i]
+		}
+		if !same {
+			t.Errorf("%s: lanes %v of %d, want %v of %d", tt.name, got, n, tt.lanes, tt.n)
+		}
+	}
+}
+func TestWriteIdeogram(t *testing.T) {
+	tests := []struct {
+		orientation, colour string
+	}{
+		{"+", "#2ca02c"},
+		{"-", "#1f77b4"},
+		{"", "#7f7f7f"},
+	}
+	for _, tt := range tests {
+		CM := plotMap()
+		for _, c := range CM.Ordered() {
+			c.Orientation = tt.orientation
+		}
+		var out strings.Builder
+		if err := WriteIdeogram(&out, []*ContigMap{CM}, testHeader()); err != nil {
+			t.Fatal(err)
+		}
+		svg := out.String()
+		// One tick per marker of the LG and one box per contig, coloured by its orientation
+		if n := strings.Count(svg, `stroke="black"><title>m`); n != 5 {
+			t.Errorf("orientation %q: %d marker ticks, want 5", tt.orientation, n)
+		}
+		if n := strings.Count(svg, `fill="`+tt.colour+`" stroke="black" stroke-width="0.5"`); n != 2 {
+			t.Errorf("orientation %q: %d contigs coloured %s, want 2 in %s", tt.orientation, n, tt.colour, svg)
+		}
+		title := "<title>a " + FormatPos(1) + "-" + FormatPos(2) + " " + tt.orientation + "</title>"
+		if !strings.Contains(svg, title) {
+			t.Errorf("orientation %q: no %s in %s", tt.orientation, title, svg)
+		}
+	}
+}
+
+func TestKendallTau(t *testing.T) {
+	tests := []struct {
+		ranks []int
+		want  float64
+	}{
+		{nil, math.NaN()},
+		{[]int{0}, math.NaN()},
+		{[]int{0, 1, 2}, 1},
+		{[]int{2, 1, 0}, -1},
+		{[]int{0, 2, 1, 3}, 4.0 / 6},
+		{[]int{3, 0, 1, 2}, 0},
+	}
+	for _, tt := range tests {
+		got := KendallTau(tt.ranks)
+		if math.IsNaN(got) != math.IsNaN(tt.want) || !math.IsNaN(got) && math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("KendallTau(%v) = %v, want %v", tt.ranks, got, tt.want)
+		}
+	}
+}
+func TestCompare(t *testing.T) {
+	// a moves from the start to the end of LG 1, c is flipped, x moves to LG 2 and y is new
+	mapsA, namesA := testResult(t, `### LG: 1
+a 1 +
+b 2 +
+c 3 -
+d 4 +
+x 5 +
+### LG: 2
+e 1 +`)
+	mapsB, namesB := testResult(t, `### LG: 1
+b 1 +
+c 2 +
+d 3 +
+a 4 +
+y 5
+### LG: 2
+e 1 +
+x 2 +`)
+	tests := []struct {
+		threshold int
+		diffs     []Difference
+	}{
+		{1, []Difference{{Reordered, "a", "1", "4"}, {Flipped, "c", "-", "+"}, {MovedLG, "x", "1", "2"}, {Appeared, "y", "-", "1"}}},
+		{0, []Difference{{Reordered, "a", "1", "4"}, {Reordered, "b", "2", "1"}, {Reordered, "c", "3", "2"}, {Flipped, "c", "-", "+"},
+			{Reordered, "d", "4", "3"}, {MovedLG, "x", "1", "2"}, {Appeared, "y", "-", "1"}}},
+		{3, []Difference{{Flipped, "c", "-", "+"}, {MovedLG, "x", "1", "2"}, {Appeared, "y", "-", "1"}}},
+	}
+	for _, tt := range tests {
+		diffs, agreement := Compare(mapsA, mapsB, namesA, namesB, tt.threshold)
+		if len(diffs) != len(tt.diffs) {
+			t.Errorf("threshold %d: differences %v, want %v", tt.threshold, diffs, tt.diffs)
+			continue
+		}
+		for i, d := range diffs {
+			if d != tt.diffs[i] {
+				t.Errorf("threshold %d: difference %v, want %v", tt.threshold, d, tt.diffs[i])
+			}
+		}
+		if len(agreement) != 2 || agreement[0] != (OrderAgreement{"1", 4, 0}) || agreement[1].Shared != 1 || !math.IsNaN(agreement[1].Tau) {
+			t.Errorf("threshold %d: agreement %v", tt.threshold, agreement)
+		}
+	}
+	// Contigs only in A disappear
+	diffs, _ := Compare(mapsB, mapsA, namesB, namesA, 4)
+	if len(diffs) != 3 || diffs[1] != (Difference{Disappeared, "y", "1", "-"}) {
+		t.Errorf("reversed comparison %v", diffs)
+	}
+}
+
+func TestLongestIncreasing(t *testing.T) {
+	tests := []struct {
+		a    []uint64
+		want []int
+	}{
+		{nil, nil},
+		{[]uint64{5}, []int{0}},
+		{[]uint64{1, 2, 3}, []int{0, 1, 2}},
+		{[]uint64{3, 1, 2}, []int{1, 2}},
+		{[]uint64{1, 5, 2, 3, 4}, []int{0, 2, 3, 4}},
+		{[]uint64{2, 2, 2}, []int{2}},
+		{[]uint64{^uint64(300), ^uint64(200), ^uint64(100)}, []int{0, 1, 2}},
+	}
+	for _, tt := range tests {
+		got := longestIncreasing(tt.a)
+		same := len(got) == len(tt.want)
+		for i := 0; same && i < len(got); i++ {
+			same = got[i] == tt.want[i]
+		}
+		if !same {
+			t.Errorf("longestIncreasing(%v) = %v, want %v", tt.a, got, tt.want)
+		}
+	}
+}
+func TestEvaluate(t *testing.T) {
+	// LG 1 follows chr1 with c out of order, b wrongly oriented, e on chr2 and f not aligned. LG 2 runs against chr3, so
+	// its contigs are expected in the opposite orientation of their alignments, and j is out of the decreasing order
+	maps, names := testResult(t, `### LG: 1
+a 1 +
+b 2 -
+c 3 +
+d 4
+e 5 +
+f 6 +
+### LG: 2
+g 1 -
+h 2 +
+i 3 -
+j 4`)
+	alignments := make(map[string]*Alignment)
+	for _, a := range []struct {
+		name, target string
+		start        uint64
+	}{{"a", "chr1", 100}, {"b", "chr1", 200}, {"c", "chr1", 400}, {"d", "chr1", 300}, {"e", "chr2", 100},
+		{"g", "chr3", 300}, {"h", "chr3", 200}, {"i", "chr3", 100}, {"j", "chr3", 250}} {
+		alignments[a.name] = &Alignment{Query: a.name, Target: a.target, Start: a.start, Strand: "+"}
+	}
+	evaluation, misplaced := Evaluate(maps, names, alignments)
+	want := []Evaluation{
+		{LG: "1", Chromosome: "chr1", Placed: 6, Aligned: 5, OnChromosome: 4, InOrder: 3, Tau: 4.0 / 6, Oriented: 3, CorrectOrient: 2},
+		{LG: "2", Chromosome: "chr3", Placed: 4, Aligned: 4, OnChromosome: 4, InOrder: 3, Tau: -2.0 / 6, Reversed: true, Oriented: 3, CorrectOrient: 2},
+	}
+	if len(evaluation) != len(want) {
+		t.Fatalf("%d evaluations, want %d", len(evaluation), len(want))
+	}
+	for i, e := range evaluation {
+		w := want[i]
+		if math.Abs(e.Tau-w.Tau) > 1e-9 {
+			t.Errorf("LG %s: tau %v, want %v", e.LG, e.Tau, w.Tau)
+		}
+		e.Tau = w.Tau
+		if e != w {
+			t.Errorf("evaluation %+v, want %+v", e, w)
+		}
+	}
+	wantMisplaced := []Misplacement{
+		{"e", "1", WrongChromosome, "chr2"},
+		{"b", "1", WrongOrientation, "+"},
+		{"c", "1", WrongOrder, "chr1:400"},
+		{"h", "2", WrongOrientation, "-"},
+		{"j", "2", WrongOrder, "chr3:250"},
+	}
+	if len(misplaced) != len(wantMisplaced) {
+		t.Fatalf("misplaced %v, want %v", misplaced, wantMisplaced)
+	}
+	for i, m := range misplaced {
+		if m != wantMisplaced[i] {
+			t.Errorf("misplaced %v, want %v", m, wantMisplaced[i])
+		}
+	}
+}
@@ -0,0 +1,322 @@
+package ContigMapping
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Actions of the curation overrides
+const (
+	ForceLG          = "force-LG"
+	ForceOrientation = "force-orientation"
+	Exclude          = "exclude"
+	PinAfter         = "pin-after"
+	PinBefore        = "pin-before"
+	SplitAt          = "split-at"
+)
+
+// Source of the orientations set by the curators
+const CurationSource = "curation"
+
+// Manual override of the placement of a contig. Value is the LG, the orientation, the anchor contig of the pins or the
+// position (bp) of the split, and Position the genetic position (cM) of a forced LG if given
+type Override struct {
+	Line     int
+	Contig   string
+	Action   string
+	Value    string
+	Position float64
+	HasPos   bool
+}
+
+func (o Override) String() string {
+	out := o.Contig + " " + o.Action
+	if o.Value != "" {
+		out += " " + o.Value
+	}
+	if o.HasPos {
+		out += " " + FormatPos(o.Position)
+	}
+	return out
+}
+
+// Pin of a contig next to its anchor in the order of a ContigMap
+type Pin struct {
+	Contig string
+	Anchor string
+	After  bool
+}
+
+// Read the curation overrides, one per line: contig<TAB>action[<TAB>value[<TAB>cM]]. The actions are:
+//
+//	force-LG <LG> [cM]         place the contig in the LG, at the given position or the one of its markers in the LG
+//	force-orientation <+|->    set the orientation of the contig
+//	exclude                    leave the contig out of the maps
+//	pin-after <contig>         place the contig right after the other one
+//	pin-before <contig>        place the contig right before the other one
+//	split-at <bp>              split the contig in <contig>_1 before the position and <contig>_2 from it
+//
+// Empty lines and lines starting with "#" are skipped
+func ReadOverrides(r io.Reader) (out []Override, err error) {
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		values := strings.Split(text, "\t")
+		for i := range values {
+			values[i] = strings.TrimSpace(values[i])
+		}
+		o := Override{Line: line, Contig: values[0]}
+		if len(values) > 1 {
+			o.Action = values[1]
+		}
+		if len(values) > 2 {
+			o.Value = values[2]
+		}
+		columns := 3
+		switch o.Action {
+		case Exclude:
+			columns = 2
+		case ForceLG:
+			if len(values) == 4 {
+				columns = 4
+				p, e := strconv.ParseFloat(values[3], 64)
+				if e != nil || math.IsNaN(p) || math.IsInf(p, 0) {
+					return out, fmt.Errorf("line %d: wrong genetic position %q", line, values[3])
+				}
+				o.Position, o.HasPos = Round(p), true
+			}
+		case ForceOrientation:
+			if o.Value != "+" && o.Value != "-" {
+				return out, fmt.Errorf("line %d: the orientation must be + or -", line)
+			}
+		case SplitAt:
+			if p, e := strconv.ParseUint(o.Value, 10, 64); e != nil || p == 0 {
+				return out, fmt.Errorf("line %d: wrong split position %q", line, o.Value)
+			}
+		case PinAfter, PinBefore:
+			if o.Value == o.Contig {
+				return out, fmt.Errorf("line %d: contig %s pinned to itself", line, o.Contig)
+			}
+		default:
+			return out, fmt.Errorf("line %d: unknown action %q, use one of %s", line, o.Action,
+				strings.Join([]string{ForceLG, ForceOrientation, Exclude, PinAfter, PinBefore, SplitAt}, ", "))
+		}
+		if len(values) != columns || o.Contig == "" || columns > 2 && o.Value == "" {
+			return out, fmt.Errorf("line %d: wrong number of columns for %s", line, o.Action)
+		}
+		out = append(out, o)
+	}
+	return out, scanner.Err()
+}
+
+// Apply the overrides in order to the completed contigs, before filtering. maps are the ContigMaps by LG and contigs all the
+// contigs by name, which are updated with the split contigs. Contigs with overrides and the anchors of the pins are marked
+// as Curated and kept by the filtering. It returns one line for each override with what was done, for the report
+func ApplyOverrides(maps map[string]*ContigMap, contigs map[string]*Contig, overrides []Override) (log []string, err error) {
+	// LG map of each placed contig
+	placed := make(map[string]*ContigMap)
+	for _, CM := range maps {
+		for name := range *CM.Contigs {
+			placed[name] = CM
+		}
+	}
+	remove := func(c *Contig) {
+		if CM, ok := placed[c.Name]; ok {
+			delete(*CM.Contigs, c.Name)
+			delete(placed, c.Name)
+		}
+	}
+	add := func(c *Contig) string {
+		CM, ok := maps[c.LG]
+		switch {
+		case ok && c.Placeable:
+			CM.AddContigs(c)
+			placed[c.Name] = CM
+			return "LG " + c.LG + " at " + FormatPos(c.GenPos) + " cM"
+		case c.Placeable && c.LG == "":
+			c.Placeable, c.Reason = false, ReasonNoMapPosition
+		case c.Placeable:
+			c.Placeable, c.Reason = false, ReasonUnknownLG
+		}
+		return "unplaced (" + c.Reason + ")"
+	}
+	for _, o := range overrides {
+		c, ok := contigs[o.Contig]
+		if !ok {
+			return log, fmt.Errorf("line %d: unknown contig %s", o.Line, o.Contig)
+		}
+		var done string
+		switch o.Action {
+		case Exclude:
+			remove(c)
+			c.Placeable, c.Reason, c.Curated = false, ReasonExcluded, false
+			done = "excluded"
+		case ForceOrientation:
+			c.Orientation, c.OrientSource, c.Curated = o.Value, CurationSource, true
+			done = "oriented " + o.Value
+		case ForceLG:
+			CM, ok := maps[o.Value]
+			if !ok {
+				return log, fmt.Errorf("line %d: unknown LG %s", o.Line, o.Value)
+			}
+			from := "unplaced"
+			if old, ok := placed[c.Name]; ok {
+				from = "LG " + old.Name
+			}
+			if err := c.force(o.Value, o.Position, o.HasPos); err != nil {
+				return log, fmt.Errorf("line %d: %v", o.Line, err)
+			}
+			remove(c)
+			CM.AddContigs(c)
+			placed[c.Name] = CM
+			done = "moved from " + from + " to LG " + o.Value + " at " + FormatPos(c.GenPos) + " cM"
+		case PinAfter, PinBefore:
+			a, ok := contigs[o.Value]
+			if !ok {
+				return log, fmt.Errorf("line %d: unknown contig %s", o.Line, o.Value)
+			}
+			CM, ok := placed[a.Name]
+			if !ok {
+				return log, fmt.Errorf("line %d: contig %s is not placed", o.Line, a.Name)
+			}
+			if old, ok := placed[c.Name]; !ok || old != CM {
+				// The pinned contig follows its anchor to the LG
+				if err := c.force(CM.Name, a.GenPos, true); err != nil {
+					return log, fmt.Errorf("line %d: %v", o.Line, err)
+				}
+				remove(c)
+				CM.AddContigs(c)
+				placed[c.Name] = CM
+			}
+			c.GenPos, c.Curated, a.Curated = a.GenPos, true, true
+			p := Marker{GenPos: a.GenPos, Weight: c.AvgWeight}
+			c.Range = [2]*Marker{&p, &p}
+			CM.Pins = append(CM.Pins, Pin{c.Name, a.Name, o.Action == PinAfter})
+			done = "pinned " + strings.TrimPrefix(o.Action, "pin-") + " " + a.Name + " in LG " + CM.Name + " at " + FormatPos(c.GenPos) + " cM"
+		case SplitAt:
+			pos, _ := strconv.ParseUint(o.Value, 10, 64)
+			parts, err := c.split(pos, contigs)
+			if err != nil {
+				return log, fmt.Errorf("line %d: %v", o.Line, err)
+			}
+			remove(c)
+			delete(contigs, c.Name)
+			done = "split"
+			for _, p := range parts {
+				if len(*p.Markers) > 0 {
+					p.Autocomplete()
+				} else {
+					p.Placeable, p.Reason = false, ReasonNoMapPosition
+				}
+				p.Curated = true
+				contigs[p.Name] = p
+				done += ", " + p.Name + " " + add(p)
+			}
+		}
+		log = append(log, o.String()+": "+done)
+	}
+	return log, nil
+}
+
+// Place the contig in the LG at the position, or if not given at the position of its markers in the LG
+func (c *Contig) force(lg string, pos float64, hasPos bool) error {
+	c.LG, c.Placeable, c.Reason, c.Curated = lg, true, "", true
+	if c.OrientSource != CurationSource {
+		c.Orientation, c.OrientSource = "", ""
+	}
+	c.AvgWeight = 0
+	var weight uint64
+	for _, m := range *c.Markers {
+		if m.LG == lg {
+			weight += m.Weight
+		}
+	}
+	if weight > 0 {
+		c.CalculateAvgWeight()
+	}
+	if hasPos {
+		c.GenPos = pos
+		p := Marker{GenPos: pos, Weight: c.AvgWeight}
+		c.Range = [2]*Marker{&p, &p}
+		return nil
+	}
+	if weight == 0 {
+		return fmt.Errorf("contig %s has no markers with weight in LG %s, give the position", c.Name, lg)
+	}
+	c.CalculateMapPos()
+	if c.OrientSource != CurationSource {
+		if _, ok := c.Orient(); !ok {
+			c.Orientation, c.OrientSource = "", ""
+		}
+		c.Placeable, c.Reason = true, ""
+	}
+	c.Range = [2]*Marker{}
+	c.CalculateRange()
+	return nil
+}
+
+// Split the contig at the position (bp) into <name>_1 and <name>_2. The markers from the position on go to the second
+// part with their positions in it. The parts are not completed
+func (c *Contig) split(pos uint64, contigs map[string]*Contig) ([2]*Contig, error) {
+	var parts [2]*Contig
+	if c.Length > 0 && pos >= c.Length {
+		return parts, fmt.Errorf("split position %d is not inside contig %s of %d bp", pos, c.Name, c.Length)
+	}
+	for i := range parts {
+		name := c.Name + "_" + strconv.Itoa(i+1)
+		if _, ok := contigs[name]; ok {
+			return parts, fmt.Errorf("cannot split contig %s, there is already a contig %s", c.Name, name)
+		}
+		parts[i] = NewContig()
+		parts[i].Name = name
+	}
+	if c.Length > 0 {
+		parts[0].Length, parts[1].Length = pos, c.Length-pos
+	}
+	for _, m := range *c.Markers {
+		if m.ConPos < float64(pos) {
+			m.Contig = parts[0].Name
+			parts[0].AddMarkers(m)
+			continue
+		}
+		m.Contig = parts[1].Name
+		m.ConPos -= float64(pos)
+		parts[1].AddMarkers(m)
+	}
+	return parts, nil
+}
+
+// Move the pinned contigs of the ordered contigs next to their anchors. Pins whose contigs are not in the map are skipped
+func (CM *ContigMap) applyPins(contigs []*Contig) []*Contig {
+	index := func(name string) int {
+		for i, c := range contigs {
+			if c.Name == name {
+				return i
+			}
+		}
+		return -1
+	}
+	for _, p := range CM.Pins {
+		i, j := index(p.Contig), index(p.Anchor)
+		if i < 0 || j < 0 {
+			continue
+		}
+		c := contigs[i]
+		contigs = append(contigs[:i], contigs[i+1:]...)
+		j = index(p.Anchor)
+		if p.After {
+			j++
+		}
+		contigs = append(contigs[:j], append([]*Contig{c}, contigs[j:]...)...)
+	}
+	return contigs
+}
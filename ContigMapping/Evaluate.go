@@ -0,0 +1,145 @@
+package ContigMapping
+
+import (
+	"sort"
+	"strconv"
+)
+
+// Kinds of misplaced contigs
+const (
+	WrongChromosome  = "chromosome"
+	WrongOrder       = "order"
+	WrongOrientation = "orientation"
+)
+
+// Struct with the accuracy of the placement of a LG measured against a reference assembly.
+// Only the contigs aligned to the chromosome of the LG count for the order and the orientation
+type Evaluation struct {
+	LG            string
+	Chromosome    string
+	Placed        int
+	Aligned       int
+	OnChromosome  int
+	InOrder       int
+	Tau           float64
+	Reversed      bool
+	Oriented      int
+	CorrectOrient int
+}
+
+// Struct with a contig placed differently than in the reference
+type Misplacement struct {
+	Contig string
+	LG     string
+	Kind   string
+	Detail string
+}
+
+// Indexes of the longest strictly increasing subsequence of a
+func longestIncreasing(a []uint64) (out []int) {
+	var tails []int
+	prev := make([]int, len(a))
+	for i, v := range a {
+		j := sort.Search(len(tails), func(k int) bool { return a[tails[k]] >= v })
+		prev[i] = -1
+		if j > 0 {
+			prev[i] = tails[j-1]
+		}
+		if j == len(tails) {
+			tails = append(tails, i)
+		} else {
+			tails[j] = i
+		}
+	}
+	if len(tails) == 0 {
+		return nil
+	}
+	out = make([]int, len(tails))
+	for i, k := len(tails)-1, tails[len(tails)-1]; i >= 0; i, k = i-1, prev[k] {
+		out[i] = k
+	}
+	return out
+}
+
+// Evaluate each LG of a placement against the alignments of the contigs to a reference assembly. The chromosome of a LG is
+// the reference sequence where most of its aligned contigs are. The order is measured on the contigs aligned to it with the
+// longest increasing (or decreasing, if the LG runs against the reference) subsequence of their reference positions and with
+// the Kendall tau. Orientations are compared with the alignment strand, flipped when the LG is reversed.
+// Returns the evaluation of each LG in the order of names and the misplaced contigs
+func Evaluate(maps map[string]*ContigMap, names []string, alignments map[string]*Alignment) (out []Evaluation, misplaced []Misplacement) {
+	for _, name := range names {
+		e := Evaluation{LG: name}
+		contigs := maps[name].Ordered()
+		e.Placed = len(contigs)
+		counts := make(map[string]int)
+		for _, c := range contigs {
+			if a, ok := alignments[c.Name]; ok {
+				e.Aligned++
+				counts[a.Target]++
+			}
+		}
+		for t, n := range counts {
+			if n > counts[e.Chromosome] || n == counts[e.Chromosome] && t < e.Chromosome {
+				e.Chromosome = t
+			}
+		}
+		var on []*Contig
+		var starts []uint64
+		for _, c := range contigs {
+			a, ok := alignments[c.Name]
+			switch {
+			case !ok:
+				continue
+			case a.Target != e.Chromosome:
+				misplaced = append(misplaced, Misplacement{c.Name, name, WrongChromosome, a.Target})
+				continue
+			}
+			on = append(on, c)
+			starts = append(starts, a.Start)
+		}
+		e.OnChromosome = len(on)
+		ranks := make([]int, len(starts))
+		for i := range starts {
+			for j := range starts {
+				if starts[j] < starts[i] {
+					ranks[i]++
+				}
+			}
+		}
+		e.Tau = KendallTau(ranks)
+		e.Reversed = e.Tau < 0
+		// The longest decreasing subsequence is the longest increasing one of the positions counted from the end
+		seq := starts
+		if e.Reversed {
+			seq = make([]uint64, len(starts))
+			for i, s := range starts {
+				seq[i] = ^s
+			}
+		}
+		inOrder := make(map[int]bool)
+		for _, i := range longestIncreasing(seq) {
+			inOrder[i] = true
+		}
+		e.InOrder = len(inOrder)
+		for i, c := range on {
+			if !inOrder[i] {
+				misplaced = append(misplaced, Misplacement{c.Name, name, WrongOrder, e.Chromosome + ":" + strconv.FormatUint(starts[i], 10)})
+			}
+			if c.Orientation == "" {
+				continue
+			}
+			e.Oriented++
+			expected := alignments[c.Name].Strand
+			if e.Reversed {
+				expected = map[string]string{"+": "-", "-": "+"}[expected]
+			}
+			if c.Orientation == expected {
+				e.CorrectOrient++
+			} else {
+				misplaced = append(misplaced, Misplacement{c.Name, name, WrongOrientation, expected})
+			}
+		}
+		out = append(out, e)
+	}
+	return out, misplaced
+}
@@ -0,0 +1,283 @@
+package ContigMapping
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Source of the adjacencies between contigs in different genetic positions, and between contigs of a bin left in arbitrary order
+const (
+	MapSource  = "map"
+	NoEvidence = "none"
+)
+
+// Struct with two adjacent contigs of an ordered ContigMap and the source of evidence for their relative order
+type Adjacency struct {
+	Before string
+	After  string
+	Source string
+}
+
+// Interface for the sources of physical evidence used to order the contigs that share a genetic position (bin).
+// Order returns the contigs in a definite order, or nil if the evidence is not enough to order all of them
+type Evidence interface {
+	Name() string
+	Order(contigs []*Contig) []*Contig
+}
+
+// Evidence from the alignment of the contigs to a reference genome
+type RefEvidence struct {
+	Alignments map[string]*Alignment
+}
+
+func (e *RefEvidence) Name() string {
+	return "reference"
+}
+
+// Order the contigs by their start in the reference. All of them must be aligned to the same reference sequence
+func (e *RefEvidence) Order(contigs []*Contig) []*Contig {
+	var target string
+	for _, c := range contigs {
+		a, ok := e.Alignments[c.Name]
+		switch {
+		case !ok:
+			return nil
+		case target == "":
+			target = a.Target
+		case a.Target != target:
+			return nil
+		}
+	}
+	out := append([]*Contig(nil), contigs...)
+	sort.SliceStable(out, func(i, j int) bool {
+		return e.Alignments[out[i].Name].Start < e.Alignments[out[j].Name].Start
+	})
+	return out
+}
+
+// Evidence from counts of links between pairs of contigs: Hi-C contacts or shared linked-read barcodes
+type LinkEvidence struct {
+	Source string
+	Links  map[[2]string]float64
+}
+
+func NewLinkEvidence(source string) *LinkEvidence {
+	return &LinkEvidence{Source: source, Links: make(map[[2]string]float64)}
+}
+
+func linkKey(a, b string) [2]string {
+	if a > b {
+		a, b = b, a
+	}
+	return [2]string{a, b}
+}
+
+// Add n links between the contigs a and b
+func (e *LinkEvidence) Add(a, b string, n float64) {
+	if a == b {
+		return
+	}
+	e.Links[linkKey(a, b)] += n
+}
+
+// Number of links between the contigs a and b
+func (e *LinkEvidence) Count(a, b string) float64 {
+	return e.Links[linkKey(a, b)]
+}
+
+func (e *LinkEvidence) Name() string {
+	return e.Source
+}
+
+// Order the contigs maximising the links between neighbours. Every contig must have links with at least one other contig of the bin.
+// Small bins are solved exhaustively, larger ones by greedily extending a chain from the strongest link
+func (e *LinkEvidence) Order(contigs []*Contig) []*Contig {
+	for _, c := range contigs {
+		linked := false
+		for _, d := range contigs {
+			if c != d && e.Count(c.Name, d.Name) > 0 {
+				linked = true
+				break
+			}
+		}
+		if !linked {
+			return nil
+		}
+	}
+	score := func(order []*Contig) (s float64) {
+		for i := 0; i < len(order)-1; i++ {
+			s += e.Count(order[i].Name, order[i+1].Name)
+		}
+		return s
+	}
+	if len(contigs) <= 8 {
+		var best []*Contig
+		bestScore := -1.0
+		perm := append([]*Contig(nil), contigs...)
+		var permute func(k int)
+		permute = func(k int) {
+			if k == len(perm) {
+				// An order and its reverse are equivalent, keep the one starting with the smallest name
+				if s := score(perm); s > bestScore && perm[0].Name <= perm[len(perm)-1].Name {
+					bestScore = s
+					best = append(best[:0], perm...)
+				}
+				return
+			}
+			for i := k; i < len(perm); i++ {
+				perm[k], perm[i] = perm[i], perm[k]
+				permute(k + 1)
+				perm[k], perm[i] = perm[i], perm[k]
+			}
+		}
+		permute(0)
+		return best
+	}
+	return e.greedyOrder(contigs)
+}
+
+// Build a chain starting from the pair with most links and extend it at both ends with the best linked contig left
+func (e *LinkEvidence) greedyOrder(contigs []*Contig) []*Contig {
+	left := make(map[*Contig]bool)
+	for _, c := range contigs {
+		left[c] = true
+	}
+	var a, b *Contig
+	best := -1.0
+	for i, c := range contigs {
+		for _, d := range contigs[i+1:] {
+			if n := e.Count(c.Name, d.Name); n > best {
+				a, b, best = c, d, n
+			}
+		}
+	}
+	chain := []*Contig{a, b}
+	delete(left, a)
+	delete(left, b)
+	for len(left) > 0 {
+		var next *Contig
+		atStart := false
+		best = -1.0
+		for _, c := range contigs {
+			if !left[c] {
+				continue
+			}
+			if n := e.Count(chain[0].Name, c.Name); n > best {
+				next, atStart, best = c, true, n
+			}
+			if n := e.Count(chain[len(chain)-1].Name, c.Name); n > best {
+				next, atStart, best = c, false, n
+			}
+		}
+		if atStart {
+			chain = append([]*Contig{next}, chain...)
+		} else {
+			chain = append(chain, next)
+		}
+		delete(left, next)
+	}
+	return chain
+}
+
+// Read a table of links between contigs with three tab separated columns: contig1, contig2 and number of links.
+// Lines starting with # are ignored
+func ReadLinks(r io.Reader, source string) (*LinkEvidence, error) {
+	out := NewLinkEvidence(source)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if scanner.Text() == "" || strings.HasPrefix(scanner.Text(), "#") {
+			continue
+		}
+		values := strings.Split(scanner.Text(), "\t")
+		if len(values) < 3 {
+			return out, fmt.Errorf("wrong number of columns in link line: %q", scanner.Text())
+		}
+		n, err := strconv.ParseFloat(values[2], 64)
+		if err != nil {
+			return out, err
+		}
+		out.Add(values[0], values[1], n)
+	}
+	return out, scanner.Err()
+}
+
+// Read a table of linked-read barcodes with two tab separated columns: contig and barcode.
+// The links between two contigs are the number of barcodes they share
+func ReadBarcodes(r io.Reader) (*LinkEvidence, error) {
+	out := NewLinkEvidence("barcodes")
+	barcodes := make(map[string]map[string]bool)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if scanner.Text() == "" || strings.HasPrefix(scanner.Text(), "#") {
+			continue
+		}
+		values := strings.Split(scanner.Text(), "\t")
+		if len(values) < 2 {
+			return out, fmt.Errorf("wrong number of columns in barcode line: %q", scanner.Text())
+		}
+		if barcodes[values[1]] == nil {
+			barcodes[values[1]] = make(map[string]bool)
+		}
+		barcodes[values[1]][values[0]] = true
+	}
+	for _, contigs := range barcodes {
+		var names []string
+		for c := range contigs {
+			names = append(names, c)
+		}
+		for i, a := range names {
+			for _, b := range names[i+1:] {
+				out.Add(a, b, 1)
+			}
+		}
+	}
+	return out, scanner.Err()
+}
+
+// Order the contigs that share a genetic position using the evidence sources, tried in the given order.
+// The BinRank of the contigs is set and the source of each adjacency of the final order is stored in Adjacencies
+func (CM *ContigMap) OrderBins(evidence ...Evidence) []Adjacency {
+	contigs := CM.Ordered()
+	source := make(map[*Contig]string)
+	for i := 0; i < len(contigs); {
+		j := i + 1
+		for j < len(contigs) && contigs[j].GenPos == contigs[i].GenPos {
+			j++
+		}
+		if j-i > 1 {
+			for _, e := range evidence {
+				order := e.Order(contigs[i:j])
+				if order == nil {
+					continue
+				}
+				for k, c := range order {
+					c.BinRank = k
+					source[c] = e.Name()
+				}
+				break
+			}
+		}
+		i = j
+	}
+	CM.Adjacencies = nil
+	contigs = CM.Ordered()
+	for i := 0; i < len(contigs)-1; i++ {
+		c1, c2 := contigs[i], contigs[i+1]
+		a := Adjacency{Before: c1.Name, After: c2.Name, Source: MapSource}
+		switch {
+		case c1.RefPlaced || c2.RefPlaced:
+			a.Source = "reference"
+		case c1.GenPos == c2.GenPos:
+			a.Source = NoEvidence
+			if s, ok := source[c1]; ok {
+				a.Source = s
+			}
+		}
+		CM.Adjacencies = append(CM.Adjacencies, a)
+	}
+	return CM.Adjacencies
+}
@@ -0,0 +1,280 @@
+package ContigMapping
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Entry of a fasta index (.fai): the length of the sequence, the offset of its first base in the file and the bases and
+// bytes of each of its lines
+type FaiEntry struct {
+	Length    uint64
+	Offset    uint64
+	LineBases uint64
+	LineWidth uint64
+}
+
+// Bases read at once when copying a sequence
+var fastaChunk uint64 = 1 << 20
+
+// Fasta file read at random with its index, so that only the part of a sequence being written is in memory
+type Fasta struct {
+	Index  map[string]FaiEntry
+	r      io.ReaderAt
+	closer func() error
+}
+
+// Fasta of r with the given index
+func NewFasta(r io.ReaderAt, index map[string]FaiEntry) *Fasta {
+	return &Fasta{Index: index, r: r, closer: func() error { return nil }}
+}
+
+// Open the fasta file with its index, read from name.fai if it exists or built by reading the file otherwise.
+// Compressed files and stdin cannot be read at random and are decompressed to a temporary file first
+func OpenFasta(name string) (*Fasta, error) {
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		magic := make([]byte, 4)
+		n, _ := io.ReadFull(f, magic)
+		if !bytes.HasPrefix(magic[:n], gzipMagic) && !bytes.HasPrefix(magic[:n], zstdMagic) {
+			index, err := fastaIndex(name, f)
+			if err != nil {
+				f.Close()
+				return nil, err
+			}
+			return &Fasta{index, f, f.Close}, nil
+		}
+		f.Close()
+	}
+	in, err := Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	tmp, err := os.CreateTemp("", "ContigMapper*.fa")
+	if err != nil {
+		return nil, err
+	}
+	// The temporary file is removed at once and disappears when it is closed
+	os.Remove(tmp.Name())
+	b := bufio.NewWriter(tmp)
+	index, err := IndexFasta(io.TeeReader(in, b))
+	if err == nil {
+		err = b.Flush()
+	}
+	if e := in.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	return &Fasta{index, tmp, tmp.Close}, nil
+}
+
+// Index of the uncompressed fasta file f, from name.fai if it exists
+func fastaIndex(name string, f *os.File) (map[string]FaiEntry, error) {
+	fai, err := os.Open(name + ".fai")
+	if err == nil {
+		defer fai.Close()
+		index, err := ReadFai(fai)
+		if err != nil {
+			return nil, fmt.Errorf("%s.fai: %v", name, err)
+		}
+		return index, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return IndexFasta(f)
+}
+
+func (f *Fasta) Close() error {
+	return f.closer()
+}
+
+// Lengths of the sequences
+func (f *Fasta) Lengths() map[string]uint64 {
+	out := make(map[string]uint64)
+	for name, e := range f.Index {
+		out[name] = e.Length
+	}
+	return out
+}
+
+// Read a fasta index (.fai) with the name, length, offset, line bases and line width of each sequence
+func ReadFai(r io.Reader) (map[string]FaiEntry, error) {
+	out := make(map[string]FaiEntry)
+	scanner := bufio.NewScanner(r)
+	n := 0
+	for scanner.Scan() {
+		n++
+		if scanner.Text() == "" {
+			continue
+		}
+		values := strings.Split(scanner.Text(), "\t")
+		if len(values) < 5 {
+			return out, fmt.Errorf("line %d: wrong number of columns in fasta index", n)
+		}
+		var v [4]uint64
+		for i := range v {
+			var err error
+			if v[i], err = strconv.ParseUint(values[i+1], 10, 64); err != nil {
+				return out, fmt.Errorf("line %d: %v", n, err)
+			}
+		}
+		e := FaiEntry{v[0], v[1], v[2], v[3]}
+		if e.Length > 0 && (e.LineBases == 0 || e.LineWidth < e.LineBases || e.LineWidth > e.LineBases+2) {
+			return out, fmt.Errorf("line %d: wrong line lengths for sequence %s", n, values[0])
+		}
+		if _, ok := out[values[0]]; ok {
+			return out, fmt.Errorf("line %d: sequence %s found twice", n, values[0])
+		}
+		out[values[0]] = e
+	}
+	return out, scanner.Err()
+}
+
+// Index a fasta file as samtools faidx does. All the lines of a sequence but the last must have the same length
+func IndexFasta(r io.Reader) (map[string]FaiEntry, error) {
+	out := make(map[string]FaiEntry)
+	b := bufio.NewReaderSize(r, 1024*1024)
+	var name string
+	var e FaiEntry
+	var offset uint64
+	n := 0
+	// Set after a line shorter than the others, which must be the last one of the sequence
+	last := false
+	for {
+		// Only the headers are kept, of the other lines only the length is needed
+		line, err := b.ReadSlice('\n')
+		header := len(line) > 0 && line[0] == '>'
+		width := uint64(len(line))
+		end := line
+		valid := header || validBases(line)
+		for err == bufio.ErrBufferFull {
+			if header {
+				return out, fmt.Errorf("line %d: header too long", n+1)
+			}
+			end, err = b.ReadSlice('\n')
+			width += uint64(len(end))
+			valid = valid && validBases(end)
+		}
+		if err != nil && err != io.EOF {
+			return out, err
+		}
+		if width == 0 {
+			break
+		}
+		n++
+		if !valid {
+			return out, fmt.Errorf("line %d: the sequence must have only letters, \"-\", \"*\" or \".\"", n)
+		}
+		bases := width - uint64(len(end)-len(bytes.TrimRight(end, "\r\n")))
+		switch {
+		case header:
+			if name != "" {
+				out[name] = e
+			}
+			fields := strings.Fields(string(line[1:]))
+			if len(fields) == 0 {
+				return out, fmt.Errorf("line %d: sequence without name", n)
+			}
+			name = fields[0]
+			if _, ok := out[name]; ok {
+				return out, fmt.Errorf("line %d: sequence %s found twice", n, name)
+			}
+			e, last = FaiEntry{Offset: offset + width}, false
+		case name == "" && bases > 0:
+			return out, fmt.Errorf("line %d: sequence before the first header", n)
+		case bases == 0:
+			last = name != ""
+		case last, bases > e.LineBases && e.LineBases > 0, bases == e.LineBases && width != e.LineWidth && err != io.EOF:
+			return out, fmt.Errorf("line %d: sequence %s has lines of different lengths", n, name)
+		case e.LineBases == 0:
+			e.LineBases, e.LineWidth, e.Length = bases, width, bases
+		default:
+			e.Length += bases
+			last = bases < e.LineBases
+		}
+		offset += width
+		if err == io.EOF {
+			break
+		}
+	}
+	if name != "" {
+		out[name] = e
+	}
+	return out, nil
+}
+
+// Check that the part of a sequence line has only bases, and the line end
+func validBases(line []byte) bool {
+	for _, b := range bytes.TrimRight(line, "\r\n") {
+		if !('A' <= b && b <= 'Z' || 'a' <= b && b <= 'z' || b == '-' || b == '*' || b == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// Copy the sequence to w, reverse complemented if reverse, reading at most fastaChunk bases at once
+func (f *Fasta) copySequence(w io.Writer, name string, reverse bool) error {
+	e, ok := f.Index[name]
+	if !ok {
+		return fmt.Errorf("no sequence for contig %s", name)
+	}
+	for done := uint64(0); done < e.Length; {
+		n := e.Length - done
+		if n > fastaChunk {
+			n = fastaChunk
+		}
+		start := done
+		if reverse {
+			start = e.Length - done - n
+		}
+		seq, err := f.read(name, e, start, start+n)
+		if err != nil {
+			return err
+		}
+		if reverse {
+			seq = ReverseComplement(seq)
+		}
+		if _, err := w.Write(seq); err != nil {
+			return err
+		}
+		done += n
+	}
+	return nil
+}
+
+// Read the bases from start to end (0-based, end excluded) of the sequence
+func (f *Fasta) read(name string, e FaiEntry, start, end uint64) ([]byte, error) {
+	pos := func(i uint64) int64 { return int64(e.Offset + i/e.LineBases*e.LineWidth + i%e.LineBases) }
+	from, to := pos(start), pos(end-1)+1
+	raw := make([]byte, to-from)
+	if n, err := f.r.ReadAt(raw, from); n < len(raw) {
+		return nil, fmt.Errorf("sequence %s: %v", name, err)
+	}
+	seq := raw[:0]
+	for _, b := range raw {
+		if b != '\n' && b != '\r' {
+			seq = append(seq, b)
+		}
+	}
+	if uint64(len(seq)) != end-start {
+		return nil, fmt.Errorf("sequence %s does not match the fasta index", name)
+	}
+	return seq, nil
+}
@@ -0,0 +1,129 @@
+package ContigMapping
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Magic bytes of the compressed formats. bgzip files are gzip files made of several members
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// Struct to close the decompressor and the file under it
+type multiCloser struct {
+	io.Reader
+	closers []func() error
+}
+
+func (m *multiCloser) Close() (err error) {
+	for _, c := range m.closers {
+		if e := c(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// Open an input file, or stdin if the name is "-". gzip, bgzip and zstd compressed inputs are detected by their magic bytes
+// and decompressed transparently. zstd needs the zstd program in the PATH
+func Open(name string) (io.ReadCloser, error) {
+	var f *os.File
+	if name == "-" {
+		f = os.Stdin
+	} else {
+		var err error
+		if f, err = os.Open(name); err != nil {
+			return nil, err
+		}
+	}
+	closeFile := func() error {
+		if f == os.Stdin {
+			return nil
+		}
+		return f.Close()
+	}
+	b := bufio.NewReader(f)
+	magic, _ := b.Peek(4)
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		z, err := gzip.NewReader(b)
+		if err != nil {
+			closeFile()
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		return &multiCloser{z, []func() error{z.Close, closeFile}}, nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		cmd := exec.Command("zstd", "-dc")
+		cmd.Stdin = b
+		out, err := cmd.StdoutPipe()
+		if err != nil {
+			closeFile()
+			return nil, err
+		}
+		if err := cmd.Start(); err != nil {
+			closeFile()
+			return nil, fmt.Errorf("%s: zstd input needs the zstd program: %v", name, err)
+		}
+		// zstd reports a truncated or corrupt input with its exit status. The rest of its output is read first so that it
+		// does not block when the input was not read to the end
+		wait := func() error {
+			io.Copy(io.Discard, out)
+			if err := cmd.Wait(); err != nil {
+				return fmt.Errorf("%s: zstd: %v", name, err)
+			}
+			return nil
+		}
+		return &multiCloser{out, []func() error{wait, closeFile}}, nil
+	}
+	return &multiCloser{b, []func() error{closeFile}}, nil
+}
+
+// Check that an input starting with the magic bytes can be decompressed, so that a missing zstd program is found before
+// any work is done
+func CheckDecompressor(magic []byte) error {
+	if bytes.HasPrefix(magic, zstdMagic) {
+		if _, err := exec.LookPath("zstd"); err != nil {
+			return fmt.Errorf("zstd compressed input needs the zstd program in the PATH: %v", err)
+		}
+	}
+	return nil
+}
+
+// Struct to close the compressor and the file under it
+type multiWriteCloser struct {
+	io.Writer
+	closers []func() error
+}
+
+func (m *multiWriteCloser) Close() (err error) {
+	for _, c := range m.closers {
+		if e := c(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// Create an output file, or write to stdout if the name is "-". Names ending in .gz are gzip compressed
+func Create(name string) (io.WriteCloser, error) {
+	if name == "-" {
+		return &multiWriteCloser{os.Stdout, nil}, nil
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasSuffix(name, ".gz") {
+		z := gzip.NewWriter(f)
+		return &multiWriteCloser{z, []func() error{z.Close, f.Close}}, nil
+	}
+	return f, nil
+}
@@ -0,0 +1,116 @@
+package ContigMapping
+
+import (
+	"math"
+	"sort"
+)
+
+// Size of the gaps of unknown length, as required by the AGP specification
+const UnknownGap uint64 = 100
+
+// Largest estimated gap. Larger estimates come from rates close to 0 and are replaced by UnknownGap
+const MaxGap uint64 = 10000000
+
+// Struct with the estimated gap between two adjacent contigs of a ContigMap.
+// Estimated is false when there was not enough information to estimate the size, in which case Size is UnknownGap
+type Gap struct {
+	Before    string
+	After     string
+	Size      uint64
+	Estimated bool
+}
+
+// Return the physical (bp) and genetic (cM) span covered by the markers of the contig in its own LG.
+// Only markers in the same LG as the contig are used.
+func (c *Contig) markerSpan() (bp, cM float64) {
+	first := true
+	var minC, maxC, minG, maxG float64
+	for _, m := range *c.Markers {
+		if m.LG != c.LG {
+			continue
+		}
+		if first {
+			minC, maxC, minG, maxG = m.ConPos, m.ConPos, m.GenPos, m.GenPos
+			first = false
+			continue
+		}
+		minC, maxC = math.Min(minC, m.ConPos), math.Max(maxC, m.ConPos)
+		minG, maxG = math.Min(minG, m.GenPos), math.Max(maxG, m.GenPos)
+	}
+	return maxC - minC, maxG - minG
+}
+
+// Recombination rate (cM/Mb) learned from the contigs of the map that have several markers spread in the genetic map and in the contig.
+// If window is larger than 0, only contigs with a genetic position within window/2 cM of centre are used.
+// It returns 0 if no contig is informative.
+func (CM *ContigMap) RecombinationRate(centre, window float64) float64 {
+	return CM.rateWindows().rate(centre, window)
+}
+
+// Informative contigs of the map sorted by genetic position, with the cumulative bp and cM spans of their markers,
+// to get the recombination rate of any window with two binary searches
+type rateWindows struct {
+	pos    []float64
+	bp, cM []float64 // Sums of the spans of the contigs before each one, with the total at the end
+}
+
+func (CM *ContigMap) rateWindows() (out rateWindows) {
+	type span struct{ pos, bp, cM float64 }
+	var spans []span
+	for _, c := range *CM.Contigs {
+		if !c.Placeable || c.LG != CM.Name {
+			continue
+		}
+		if b, g := c.markerSpan(); b > 0 && g > 0 {
+			spans = append(spans, span{c.GenPos, b, g})
+		}
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].pos < spans[j].pos })
+	out.bp, out.cM = make([]float64, len(spans)+1), make([]float64, len(spans)+1)
+	for i, s := range spans {
+		out.pos = append(out.pos, s.pos)
+		out.bp[i+1], out.cM[i+1] = out.bp[i]+s.bp, out.cM[i]+s.cM
+	}
+	return out
+}
+
+func (r rateWindows) rate(centre, window float64) float64 {
+	from, to := 0, len(r.pos)
+	if window > 0 {
+		from = sort.SearchFloat64s(r.pos, centre-window/2)
+		to = sort.Search(len(r.pos), func(i int) bool { return r.pos[i] > centre+window/2 })
+	}
+	if from >= to || r.bp[to]-r.bp[from] <= 0 {
+		return 0
+	}
+	return (r.cM[to] - r.cM[from]) / ((r.bp[to] - r.bp[from]) / 1e6)
+}
+
+// Estimate the gaps between the adjacent contigs of the ordered map.
+// The genetic distance between the end of a contig and the beginning of the next one is converted into bp with the recombination rate
+// of the LG, or of a sliding window of the given size (cM) around the gap when window > 0, falling back to the LG rate.
+// Gaps that cannot be estimated (no rate or overlapping contigs) or that would be larger than MaxGap, as happens where
+// the rate is close to 0, get the UnknownGap size.
+func (CM *ContigMap) EstimateGaps(window float64) (out []Gap) {
+	contigs := CM.Ordered()
+	windows := CM.rateWindows()
+	lgRate := windows.rate(0, 0)
+	for i := 0; i < len(contigs)-1; i++ {
+		c1, c2 := contigs[i], contigs[i+1]
+		g := Gap{Before: c1.Name, After: c2.Name, Size: UnknownGap}
+		d := c2.Range[0].GenPos - c1.Range[1].GenPos
+		rate := lgRate
+		if window > 0 {
+			if r := windows.rate(c1.Range[1].GenPos+d/2, window); r > 0 {
+				rate = r
+			}
+		}
+		if d > 0 && rate > 0 {
+			if size := math.Round(d / rate * 1e6); size >= 1 && size <= float64(MaxGap) {
+				g.Size, g.Estimated = uint64(size), true
+			}
+		}
+		out = append(out, g)
+	}
+	return out
+}
@@ -0,0 +1,85 @@
+package ContigMapping
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Version and configuration of the run that wrote an output, so that it can be reproduced. The text outputs start with
+// it as comment lines and the JSON outputs have it as their "header" object. Notes are other lines about the run, like
+// the curation overrides. A nil header writes nothing
+type RunHeader struct {
+	Version string            `json:"version"`
+	Command string            `json:"command"`
+	Config  map[string]string `json:"config"`
+	Notes   []string          `json:"notes,omitempty"`
+}
+
+// Names of the options in order
+func (h *RunHeader) options() []string {
+	var out []string
+	for k := range h.Config {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Header as comment lines starting with the prefix. Without the prefix, the lines of the options are a valid TOML
+// configuration file to repeat the run
+func (h *RunHeader) Comment(prefix string) string {
+	if h == nil {
+		return ""
+	}
+	out := prefix + " ContigMapper " + h.Version + " " + h.Command + "\n"
+	for _, k := range h.options() {
+		out += prefix + " " + k + " = " + strconv.Quote(h.Config[k]) + "\n"
+	}
+	for _, n := range h.Notes {
+		out += prefix + " " + n + "\n"
+	}
+	return out
+}
+
+// Header as VCF meta-information lines, named after the command as bcftools does
+func (h *RunHeader) vcf() string {
+	if h == nil {
+		return ""
+	}
+	name := "##ContigMapper_" + h.Command
+	var options []string
+	for _, k := range h.options() {
+		options = append(options, "-"+k+"="+strconv.Quote(h.Config[k]))
+	}
+	out := name + "Version=" + h.Version + "\n" + name + "Command=" + strings.Join(options, " ") + "\n"
+	for _, n := range h.Notes {
+		out += name + "Note=" + n + "\n"
+	}
+	return out
+}
+
+// Header as an XML comment, for the SVG plots. "--" cannot be in a comment and is written as "- -"
+func (h *RunHeader) xml() string {
+	if h == nil {
+		return ""
+	}
+	text := h.Comment("")
+	for strings.Contains(text, "--") {
+		text = strings.ReplaceAll(text, "--", "- -")
+	}
+	return "<!--\n" + text + "-->\n"
+}
+
+// Header as the "header" member of a JSON object, with the comma after it
+func (h *RunHeader) json(indent string) (string, error) {
+	if h == nil {
+		return "", nil
+	}
+	data, err := json.MarshalIndent(h, indent, "  ")
+	if err != nil {
+		return "", err
+	}
+	return "\"header\": " + string(data) + ",\n" + indent, nil
+}
@@ -0,0 +1,201 @@
+package ContigMapping
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Ends of a contig in its own coordinates
+const (
+	Start = 0
+	End   = 1
+)
+
+type endKey struct {
+	a    string
+	aEnd int
+	b    string
+	bEnd int
+}
+
+// Struct with Hi-C contacts between the ends of contigs. Each contig is split in two halves,
+// contacts in the first half are counted for its Start and the rest for its End
+type HiC struct {
+	Ends    map[endKey]float64
+	Lengths map[string]uint64
+	links   *LinkEvidence
+}
+
+// Struct with a contig for which the genetic map and the Hi-C contacts suggest different orientations
+type OrientConflict struct {
+	Contig string
+	Map    string
+	HiC    string
+}
+
+func NewHiC(lengths map[string]uint64) *HiC {
+	if lengths == nil {
+		lengths = make(map[string]uint64)
+	}
+	return &HiC{Ends: make(map[endKey]float64), Lengths: lengths, links: NewLinkEvidence("hic")}
+}
+
+// Add n contacts between the end aEnd of contig a and the end bEnd of contig b
+func (h *HiC) Add(a string, aEnd int, b string, bEnd int, n float64) {
+	if a == b {
+		return
+	}
+	if a > b {
+		a, aEnd, b, bEnd = b, bEnd, a, aEnd
+	}
+	h.Ends[endKey{a, aEnd, b, bEnd}] += n
+	h.links.Add(a, b, n)
+}
+
+// Number of contacts between the end aEnd of contig a and any end of contig b
+func (h *HiC) Contacts(a string, aEnd int, b string) float64 {
+	if a > b {
+		return h.Ends[endKey{b, Start, a, aEnd}] + h.Ends[endKey{b, End, a, aEnd}]
+	}
+	return h.Ends[endKey{a, aEnd, b, Start}] + h.Ends[endKey{a, aEnd, b, End}]
+}
+
+// The contacts between contigs regardless of the ends, to be used as evidence for ordering the contigs in a bin
+func (h *HiC) Links() *LinkEvidence {
+	return h.links
+}
+
+// Return the end of the contig where the position falls, or -1 if the length of the contig is unknown
+func (h *HiC) end(contig string, pos uint64) int {
+	l, ok := h.Lengths[contig]
+	switch {
+	case !ok || l == 0:
+		return -1
+	case pos <= l/2:
+		return Start
+	default:
+		return End
+	}
+}
+
+// Read a 4DN pairs file. Contig lengths are taken from the #chromsize header lines when present.
+// Pairs on contigs of unknown length count as links but cannot be used for orientation
+func ReadPairs(r io.Reader, lengths map[string]uint64) (*HiC, error) {
+	h := NewHiC(lengths)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		if strings.HasPrefix(text, "#chromsize:") {
+			values := strings.Fields(strings.TrimPrefix(text, "#chromsize:"))
+			if len(values) == 2 {
+				if l, err := strconv.ParseUint(values[1], 10, 64); err == nil {
+					h.Lengths[values[0]] = l
+				}
+			}
+			continue
+		}
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		values := strings.Fields(text)
+		if len(values) < 5 {
+			return h, fmt.Errorf("line %d: pairs needs at least 5 columns, found %d", line, len(values))
+		}
+		p1, err := strconv.ParseUint(values[2], 10, 64)
+		if err != nil {
+			return h, fmt.Errorf("line %d: %v", line, err)
+		}
+		p2, err := strconv.ParseUint(values[4], 10, 64)
+		if err != nil {
+			return h, fmt.Errorf("line %d: %v", line, err)
+		}
+		e1, e2 := h.end(values[1], p1), h.end(values[3], p2)
+		if e1 < 0 || e2 < 0 {
+			h.links.Add(values[1], values[3], 1)
+			continue
+		}
+		h.Add(values[1], e1, values[3], e2, 1)
+	}
+	return h, scanner.Err()
+}
+
+// Read a table of contacts between contig ends with five tab separated columns:
+// contig1, end1, contig2, end2 and count. Ends are "start" or "end"
+func ReadEndLinks(r io.Reader) (*HiC, error) {
+	h := NewHiC(nil)
+	ends := map[string]int{"start": Start, "end": End}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if scanner.Text() == "" || strings.HasPrefix(scanner.Text(), "#") {
+			continue
+		}
+		values := strings.Split(scanner.Text(), "\t")
+		if len(values) < 5 {
+			return h, fmt.Errorf("wrong number of columns in contact line: %q", scanner.Text())
+		}
+		e1, ok1 := ends[values[1]]
+		e2, ok2 := ends[values[3]]
+		if !ok1 || !ok2 {
+			return h, fmt.Errorf("contig ends must be start or end: %q", scanner.Text())
+		}
+		n, err := strconv.ParseFloat(values[4], 64)
+		if err != nil {
+			return h, err
+		}
+		h.Add(values[0], e1, values[2], e2, n)
+	}
+	return h, scanner.Err()
+}
+
+// Orientation of the contig that maximises the contacts with its neighbours in the ordered map:
+// "+" when its end faces the next contig and its start the previous one, "-" for the opposite, "" when there is a tie
+func (h *HiC) orientation(prev, c, next *Contig) string {
+	var plus, minus float64
+	if prev != nil {
+		plus += h.Contacts(c.Name, Start, prev.Name)
+		minus += h.Contacts(c.Name, End, prev.Name)
+	}
+	if next != nil {
+		plus += h.Contacts(c.Name, End, next.Name)
+		minus += h.Contacts(c.Name, Start, next.Name)
+	}
+	switch {
+	case plus > minus:
+		return "+"
+	case minus > plus:
+		return "-"
+	}
+	return ""
+}
+
+// Orient the contigs of the ordered map with the Hi-C contacts with their neighbours.
+// Only contigs left without orientation by the genetic map are changed. The contigs where both sources disagree are returned
+func (CM *ContigMap) OrientHiC(h *HiC) (out []OrientConflict) {
+	contigs := CM.Ordered()
+	for i, c := range contigs {
+		var prev, next *Contig
+		if i > 0 {
+			prev = contigs[i-1]
+		}
+		if i < len(contigs)-1 {
+			next = contigs[i+1]
+		}
+		o := h.orientation(prev, c, next)
+		switch {
+		case o == "":
+			continue
+		case c.Orientation == "":
+			c.Orientation = o
+			c.OrientSource = "hic"
+		case c.Orientation != o:
+			out = append(out, OrientConflict{Contig: c.Name, Map: c.Orientation, HiC: o})
+		}
+	}
+	return out
+}
@@ -0,0 +1,429 @@
+package ContigMapping
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Piece of a contig in a pseudomolecule. Coordinates are 0-based
+type Segment struct {
+	Contig      string
+	ContigStart uint64
+	LG          string
+	Start       uint64
+	Length      uint64
+	Reverse     bool
+}
+
+// Conversion of coordinates from the contigs to the pseudomolecules
+type Liftover struct {
+	Segments    map[string][]Segment // Segments of each contig, sorted by ContigStart
+	Sizes       map[string]uint64    // Length of each pseudomolecule
+	Names       []string             // Pseudomolecules in the order of the layout
+	contigSizes map[string]uint64
+}
+
+func newLiftover() *Liftover {
+	return &Liftover{Segments: make(map[string][]Segment), Sizes: make(map[string]uint64), contigSizes: make(map[string]uint64)}
+}
+
+// Add a segment and update the sizes of its contig and pseudomolecule
+func (l *Liftover) add(s Segment) {
+	if _, ok := l.Sizes[s.LG]; !ok {
+		l.Names = append(l.Names, s.LG)
+	}
+	l.Segments[s.Contig] = append(l.Segments[s.Contig], s)
+	if end := s.Start + s.Length; end > l.Sizes[s.LG] {
+		l.Sizes[s.LG] = end
+	}
+	if end := s.ContigStart + s.Length; end > l.contigSizes[s.Contig] {
+		l.contigSizes[s.Contig] = end
+	}
+}
+
+func (l *Liftover) sort() {
+	for _, segments := range l.Segments {
+		sort.Slice(segments, func(i, j int) bool { return segments[i].ContigStart < segments[j].ContigStart })
+	}
+}
+
+// Build the liftover from the placements of the LGs, as written in AGP by the same placements. Contig lengths must be known
+func NewLiftover(placements []Placement) (*Liftover, error) {
+	l := newLiftover()
+	for _, p := range placements {
+		if p.Length == 0 {
+			return nil, fmt.Errorf("unknown length for contig %s", p.Contig)
+		}
+		if _, ok := l.Segments[p.Contig]; ok {
+			return nil, fmt.Errorf("contig %s placed twice", p.Contig)
+		}
+		l.add(Segment{Contig: p.Contig, LG: p.LG, Start: p.Start, Length: p.Length, Reverse: p.Orientation == "-"})
+	}
+	l.sort()
+	return l, nil
+}
+
+// Read the liftover from an AGP file. Each component line is a segment, and components without "-" orientation are forward
+func ReadLiftoverAGP(r io.Reader) (*Liftover, error) {
+	l := newLiftover()
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		values := strings.Split(text, "\t")
+		if len(values) < 9 {
+			return nil, fmt.Errorf("line %d: AGP needs 9 columns, found %d", line, len(values))
+		}
+		var pos [4]uint64
+		for i, v := range []string{values[1], values[2], values[6], values[7]} {
+			if i >= 2 && (values[4] == "N" || values[4] == "U") {
+				break
+			}
+			n, err := strconv.ParseUint(v, 10, 64)
+			if err != nil || n == 0 {
+				return nil, fmt.Errorf("line %d: wrong coordinate %q", line, v)
+			}
+			pos[i] = n
+		}
+		if pos[1] < pos[0] {
+			return nil, fmt.Errorf("line %d: object end before its start", line)
+		}
+		if values[4] == "N" || values[4] == "U" {
+			if _, ok := l.Sizes[values[0]]; !ok {
+				l.Names = append(l.Names, values[0])
+			}
+			if pos[1] > l.Sizes[values[0]] {
+				l.Sizes[values[0]] = pos[1]
+			}
+			continue
+		}
+		if pos[3] < pos[2] || pos[3]-pos[2] != pos[1]-pos[0] {
+			return nil, fmt.Errorf("line %d: component and object lengths differ", line)
+		}
+		l.add(Segment{Contig: values[5], ContigStart: pos[2] - 1, LG: values[0], Start: pos[0] - 1, Length: pos[1] - pos[0] + 1, Reverse: values[8] == "-"})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	l.sort()
+	return l, nil
+}
+
+// Convert the interval [start, end) (0-based) of the contig to the pseudomolecule. The interval must be in a single segment.
+// It returns the pseudomolecule, the interval in it, if the segment is reversed and if the conversion was possible
+func (l *Liftover) Lift(contig string, start, end uint64) (lg string, s, e uint64, reverse, ok bool) {
+	if end < start {
+		return "", 0, 0, false, false
+	}
+	for _, seg := range l.Segments[contig] {
+		segEnd := seg.ContigStart + seg.Length
+		if start < seg.ContigStart || end > segEnd || start >= segEnd && end > start {
+			continue
+		}
+		if seg.Reverse {
+			return seg.LG, seg.Start + segEnd - end, seg.Start + segEnd - start, true, true
+		}
+		return seg.LG, seg.Start + start - seg.ContigStart, seg.Start + end - seg.ContigStart, false, true
+	}
+	return "", 0, 0, false, false
+}
+
+// Write the liftover as a UCSC chain file from the contigs to the pseudomolecules, with one chain per segment,
+// after the header of the run as comment lines
+func (l *Liftover) WriteChain(w io.Writer, h *RunHeader) error {
+	b := bufio.NewWriter(w)
+	b.WriteString(h.Comment("##"))
+	var contigs []string
+	for c := range l.Segments {
+		contigs = append(contigs, c)
+	}
+	sort.Strings(contigs)
+	id := 0
+	for _, c := range contigs {
+		for _, s := range l.Segments[c] {
+			id++
+			strand, qStart := "+", s.Start
+			if s.Reverse {
+				strand, qStart = "-", l.Sizes[s.LG]-s.Start-s.Length
+			}
+			fmt.Fprintf(b, "chain %d %s %d + %d %d %s %d %s %d %d %d\n%d\n\n", s.Length, c, l.contigSizes[c], s.ContigStart, s.ContigStart+s.Length,
+				s.LG, l.Sizes[s.LG], strand, qStart, qStart+s.Length, id, s.Length)
+		}
+	}
+	return b.Flush()
+}
+
+// Reasons why a record could not be lifted, written before it in the unlifted output
+const (
+	UnliftedMissing   = "not in a placed contig"
+	UnliftedSplit     = "not in a single segment of the contig"
+	UnliftedMalformed = "malformed record"
+	UnliftedReversed  = "cannot be reverse complemented"
+)
+
+// Counts of a liftover of records
+type LiftCounts struct {
+	Lifted   int
+	Unlifted int
+}
+
+// Lift the lines of r to w. Each line is first passed to header, which tells if it is not a record and returns the lines
+// to write instead. lift converts a record, or returns the reason why it cannot be lifted. Unlifted records are written
+// to unlifted, if not nil, after a "#reason" line. The comment lines describing the run start both outputs, or come
+// after the first line of the input if it starts with first, as the version line of the formats must be the first one
+func liftLines(r io.Reader, w, unlifted io.Writer, comment, first string, header func(line string) (string, bool), lift func(fields []string) (string, string)) (LiftCounts, error) {
+	var counts LiftCounts
+	out := bufio.NewWriter(w)
+	var un *bufio.Writer
+	if unlifted != nil {
+		un = bufio.NewWriter(unlifted)
+		un.WriteString(comment)
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 1024*1024), 1024*1024*1024)
+	commented := false
+	for scanner.Scan() {
+		text := scanner.Text()
+		if !commented {
+			commented = true
+			if first != "" && strings.HasPrefix(text, first) {
+				h, _ := header(text)
+				out.WriteString(h + comment)
+				continue
+			}
+			out.WriteString(comment)
+		}
+		if text == "" {
+			continue
+		}
+		if h, ok := header(text); ok {
+			out.WriteString(h)
+			continue
+		}
+		line, reason := lift(strings.Split(text, "\t"))
+		if reason != "" {
+			counts.Unlifted++
+			if un != nil {
+				un.WriteString("#" + reason + "\n" + text + "\n")
+			}
+			continue
+		}
+		counts.Lifted++
+		out.WriteString(line + "\n")
+	}
+	if err := scanner.Err(); err != nil {
+		return counts, err
+	}
+	if !commented {
+		out.WriteString(comment)
+	}
+	if un != nil {
+		if err := un.Flush(); err != nil {
+			return counts, err
+		}
+	}
+	return counts, out.Flush()
+}
+
+// Reason why the interval of a contig could not be lifted
+func (l *Liftover) unliftable(contig string) string {
+	if len(l.Segments[contig]) == 0 {
+		return UnliftedMissing
+	}
+	return UnliftedSplit
+}
+
+func flipStrand(strand string) string {
+	switch strand {
+	case "+":
+		return "-"
+	case "-":
+		return "+"
+	}
+	return strand
+}
+
+// Lift the BED records of r from the contigs to the pseudomolecules. The strand and the thick part are converted too,
+// and the blocks of BED12 records on reversed contigs are reversed. Track, browser and comment lines are kept, after the
+// header of the run
+func (l *Liftover) LiftBED(r io.Reader, w, unlifted io.Writer, h *RunHeader) (LiftCounts, error) {
+	header := func(line string) (string, bool) {
+		if strings.HasPrefix(line, "#") || strings.HasPrefix(line, "track") || strings.HasPrefix(line, "browser") {
+			return line + "\n", true
+		}
+		return "", false
+	}
+	return liftLines(r, w, unlifted, h.Comment("##"), "", header, func(f []string) (string, string) {
+		if len(f) < 3 {
+			return "", UnliftedMalformed
+		}
+		start, err1 := strconv.ParseUint(f[1], 10, 64)
+		end, err2 := strconv.ParseUint(f[2], 10, 64)
+		if err1 != nil || err2 != nil || end < start {
+			return "", UnliftedMalformed
+		}
+		lg, s, e, reverse, ok := l.Lift(f[0], start, end)
+		if !ok {
+			return "", l.unliftable(f[0])
+		}
+		out := append([]string{lg, strconv.FormatUint(s, 10), strconv.FormatUint(e, 10)}, f[3:]...)
+		if reverse && len(f) >= 6 {
+			out[5] = flipStrand(f[5])
+		}
+		if len(f) >= 8 {
+			ts, err1 := strconv.ParseUint(f[6], 10, 64)
+			te, err2 := strconv.ParseUint(f[7], 10, 64)
+			if err1 != nil || err2 != nil || ts < start || te > end || te < ts {
+				return "", UnliftedMalformed
+			}
+			_, ts, te, _, _ = l.Lift(f[0], ts, te)
+			out[6], out[7] = strconv.FormatUint(ts, 10), strconv.FormatUint(te, 10)
+		}
+		if reverse && len(f) >= 12 {
+			sizes, starts, ok := reverseBlocks(f[10], f[11], end-start)
+			if !ok {
+				return "", UnliftedMalformed
+			}
+			out[10], out[11] = sizes, starts
+		}
+		return strings.Join(out, "\t"), ""
+	})
+}
+
+// Reverse the blocks of a BED12 record of the given length
+func reverseBlocks(sizes, starts string, length uint64) (string, string, bool) {
+	sz := strings.Split(strings.TrimSuffix(sizes, ","), ",")
+	st := strings.Split(strings.TrimSuffix(starts, ","), ",")
+	if len(sz) != len(st) {
+		return "", "", false
+	}
+	newSizes, newStarts := make([]string, len(sz)), make([]string, len(st))
+	for i := range sz {
+		size, err1 := strconv.ParseUint(sz[i], 10, 64)
+		start, err2 := strconv.ParseUint(st[i], 10, 64)
+		if err1 != nil || err2 != nil || start+size > length {
+			return "", "", false
+		}
+		j := len(sz) - 1 - i
+		newSizes[j], newStarts[j] = sz[i], strconv.FormatUint(length-start-size, 10)
+	}
+	return strings.Join(newSizes, ",") + ",", strings.Join(newStarts, ",") + ",", true
+}
+
+// Lift the GFF3 records of r from the contigs to the pseudomolecules, flipping the strand on reversed contigs.
+// The ##sequence-region directives are replaced by those of the pseudomolecules and the ##FASTA section is left out.
+// The header of the run is written as comment lines after the ##gff-version directive
+func (l *Liftover) LiftGFF(r io.Reader, w, unlifted io.Writer, h *RunHeader) (LiftCounts, error) {
+	fasta := false
+	header := func(line string) (string, bool) {
+		switch {
+		case fasta || strings.HasPrefix(line, "##sequence-region"):
+			return "", true
+		case strings.HasPrefix(line, "##FASTA"):
+			fasta = true
+			return "", true
+		case strings.HasPrefix(line, "##gff-version"):
+			out := line + "\n"
+			for _, lg := range l.Names {
+				out += fmt.Sprintf("##sequence-region %s 1 %d\n", gffEscaper.Replace(lg), l.Sizes[lg])
+			}
+			return out, true
+		}
+		return line + "\n", strings.HasPrefix(line, "#")
+	}
+	return liftLines(r, w, unlifted, h.Comment("#"), "##gff-version", header, func(f []string) (string, string) {
+		if len(f) != 9 {
+			return "", UnliftedMalformed
+		}
+		start, err1 := strconv.ParseUint(f[3], 10, 64)
+		end, err2 := strconv.ParseUint(f[4], 10, 64)
+		if err1 != nil || err2 != nil || start == 0 || end < start {
+			return "", UnliftedMalformed
+		}
+		lg, s, e, reverse, ok := l.Lift(f[0], start-1, end)
+		if !ok {
+			return "", l.unliftable(f[0])
+		}
+		out := append([]string(nil), f...)
+		out[0], out[3], out[4] = gffEscaper.Replace(lg), strconv.FormatUint(s+1, 10), strconv.FormatUint(e, 10)
+		if reverse {
+			out[6] = flipStrand(f[6])
+		}
+		return strings.Join(out, "\t"), ""
+	})
+}
+
+var vcfBases = regexp.MustCompile(`^[ACGTNacgtn]+$`)
+var vcfEnd = regexp.MustCompile(`(^|;)END=(\d+)`)
+
+// Lift the VCF records of r from the contigs to the pseudomolecules. The ##contig lines are replaced by those of the
+// pseudomolecules. On reversed contigs the alleles are reverse complemented, which is only possible when all of them
+// are bases of the same length as the reference: indels, symbolic alleles and records with END are left unlifted there.
+// The header of the run is written as meta-information lines after the ##fileformat line
+func (l *Liftover) LiftVCF(r io.Reader, w, unlifted io.Writer, h *RunHeader) (LiftCounts, error) {
+	header := func(line string) (string, bool) {
+		switch {
+		case strings.HasPrefix(line, "##contig="):
+			return "", true
+		case strings.HasPrefix(line, "#CHROM"):
+			out := ""
+			for _, lg := range l.Names {
+				out += fmt.Sprintf("##contig=<ID=%s,length=%d>\n", lg, l.Sizes[lg])
+			}
+			return out + line + "\n", true
+		}
+		return line + "\n", strings.HasPrefix(line, "#")
+	}
+	return liftLines(r, w, unlifted, h.vcf(), "##fileformat", header, func(f []string) (string, string) {
+		if len(f) < 8 {
+			return "", UnliftedMalformed
+		}
+		pos, err := strconv.ParseUint(f[1], 10, 64)
+		if err != nil || pos == 0 || f[3] == "" {
+			return "", UnliftedMalformed
+		}
+		end := pos - 1 + uint64(len(f[3]))
+		info := vcfEnd.FindStringSubmatchIndex(f[7])
+		if info != nil {
+			if end, err = strconv.ParseUint(f[7][info[4]:info[5]], 10, 64); err != nil || end < pos {
+				return "", UnliftedMalformed
+			}
+		}
+		lg, s, e, reverse, ok := l.Lift(f[0], pos-1, end)
+		if !ok {
+			return "", l.unliftable(f[0])
+		}
+		out := append([]string(nil), f...)
+		out[0], out[1] = lg, strconv.FormatUint(s+1, 10)
+		if info != nil {
+			out[7] = f[7][:info[4]] + strconv.FormatUint(e, 10) + f[7][info[5]:]
+		}
+		if !reverse {
+			return strings.Join(out, "\t"), ""
+		}
+		if info != nil || !vcfBases.MatchString(f[3]) {
+			return "", UnliftedReversed
+		}
+		out[3] = string(ReverseComplement([]byte(f[3])))
+		if f[4] != "." {
+			alts := strings.Split(f[4], ",")
+			for i, a := range alts {
+				if len(a) != len(f[3]) || !vcfBases.MatchString(a) {
+					return "", UnliftedReversed
+				}
+				alts[i] = string(ReverseComplement([]byte(a)))
+			}
+			out[4] = strings.Join(alts, ",")
+		}
+		return strings.Join(out, "\t"), ""
+	})
+}
@@ -0,0 +1,333 @@
+package ContigMapping
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Version of the model format written by WriteModel
+const ModelVersion = 1
+
+// Full ContigMap model in JSON, with the markers of the genetic map, the contigs with their markers and the computed fields.
+// The markers are written in full wherever they appear and are shared again by name when the model is read.
+// The model is {"version": ModelVersion, "header": {...}, "maps": [...]}, or one map per line in JSON Lines after a line
+// with the header
+type mapModelJSON struct {
+	Name        string            `json:"name"`
+	Filtered    bool              `json:"filtered"`
+	Deleted     int               `json:"deleted"`
+	Markers     []markerJSON      `json:"markers"`
+	Contigs     []contigModelJSON `json:"contigs"`
+	Adjacencies []adjacencyJSON   `json:"adjacencies,omitempty"`
+}
+
+type markerJSON struct {
+	Name   string  `json:"name"`
+	LG     string  `json:"lg"`
+	Contig string  `json:"contig"`
+	GenPos float64 `json:"genpos"`
+	ConPos float64 `json:"conpos"`
+	Weight uint64  `json:"weight"`
+}
+
+// End of the range of a contig. Marker is empty when the end is not one of the markers of the contig
+type rangeJSON struct {
+	Marker string  `json:"marker,omitempty"`
+	GenPos float64 `json:"genpos"`
+	Weight uint64  `json:"weight"`
+}
+
+type contigModelJSON struct {
+	Name         string       `json:"name"`
+	LG           string       `json:"lg"`
+	GenPos       float64      `json:"genpos"`
+	AvgWeight    uint64       `json:"avgweight"`
+	Orientation  string       `json:"orientation"`
+	OrientSource string       `json:"orientsource,omitempty"`
+	Range        []rangeJSON  `json:"range,omitempty"`
+	Placeable    bool         `json:"placeable"`
+	Reason       string       `json:"reason,omitempty"`
+	Length       uint64       `json:"length,omitempty"`
+	BinRank      int          `json:"binrank"`
+	RefPlaced    bool         `json:"refplaced,omitempty"`
+	Markers      []markerJSON `json:"markers"`
+}
+
+type adjacencyJSON struct {
+	Before string `json:"before"`
+	After  string `json:"after"`
+	Source string `json:"source"`
+}
+
+// Markers of the map sorted by name, in JSON
+func markersJSON(markers *map[string]*Marker) []markerJSON {
+	out := []markerJSON{}
+	for _, m := range sortedMarkers(markers) {
+		out = append(out, markerJSON{m.Name, m.LG, m.Contig, m.GenPos, m.ConPos, m.Weight})
+	}
+	return out
+}
+
+// Model of the contig in JSON
+func (c *Contig) modelJSON() contigModelJSON {
+	out := contigModelJSON{Name: c.Name, LG: c.LG, GenPos: c.GenPos, AvgWeight: c.AvgWeight, Orientation: c.Orientation, OrientSource: c.OrientSource,
+		Placeable: c.Placeable, Reason: c.Reason, Length: c.Length, BinRank: c.BinRank, RefPlaced: c.RefPlaced, Markers: markersJSON(c.Markers)}
+	if c.Range[0] != nil && c.Range[1] != nil {
+		for _, m := range c.Range {
+			r := rangeJSON{GenPos: m.GenPos, Weight: m.Weight}
+			if (*c.Markers)[m.Name] == m {
+				r.Marker = m.Name
+			}
+			out.Range = append(out.Range, r)
+		}
+	}
+	return out
+}
+
+// Contigs of the map sorted by name
+func sortedContigs(contigs map[string]*Contig) (out []*Contig) {
+	for _, c := range contigs {
+		out = append(out, c)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Model of the ContigMap in JSON, with the contigs sorted by name
+func (CM *ContigMap) modelJSON() mapModelJSON {
+	out := mapModelJSON{Name: CM.Name, Filtered: CM.Filtered, Deleted: CM.Deleted, Markers: markersJSON(CM.Markers), Contigs: []contigModelJSON{}}
+	for _, c := range sortedContigs(*CM.Contigs) {
+		out.Contigs = append(out.Contigs, c.modelJSON())
+	}
+	for _, a := range CM.Adjacencies {
+		out.Adjacencies = append(out.Adjacencies, adjacencyJSON{a.Before, a.After, a.Source})
+	}
+	return out
+}
+
+// Write the full model of the ContigMaps in JSON, with the LGs in the order of names and the header of the run if not nil.
+// With lines it writes JSON Lines instead: the header on the first line and one ContigMap on each of the next ones
+func WriteModel(w io.Writer, maps map[string]*ContigMap, names []string, lines bool, h *RunHeader) error {
+	if !lines {
+		return writeModel(w, maps, names, nil, h)
+	}
+	b := bufio.NewWriter(w)
+	enc := json.NewEncoder(b)
+	if h != nil {
+		if err := enc.Encode(struct {
+			Header *RunHeader `json:"header"`
+		}{h}); err != nil {
+			return err
+		}
+	}
+	for _, name := range names {
+		if err := enc.Encode(maps[name].modelJSON()); err != nil {
+			return err
+		}
+	}
+	return b.Flush()
+}
+
+// Write the snapshot of a run after the contigs are completed: the model of the ContigMaps in JSON, with the contigs that
+// are in none of them listed as "unplaced". ReadSnapshot reads it back with all the contigs, so that filtering and the
+// outputs can be run again without parsing the inputs
+func WriteSnapshot(w io.Writer, maps map[string]*ContigMap, names []string, contigs map[string]*Contig, h *RunHeader) error {
+	placed := make(map[*Contig]bool)
+	for _, CM := range maps {
+		for _, c := range *CM.Contigs {
+			placed[c] = true
+		}
+	}
+	unplaced := []contigModelJSON{}
+	for _, c := range sortedContigs(contigs) {
+		if !placed[c] {
+			unplaced = append(unplaced, c.modelJSON())
+		}
+	}
+	return writeModel(w, maps, names, unplaced, h)
+}
+
+// Write the model in JSON, and the unplaced contigs if not nil
+func writeModel(w io.Writer, maps map[string]*ContigMap, names []string, unplaced []contigModelJSON, h *RunHeader) error {
+	header, err := h.json("  ")
+	if err != nil {
+		return err
+	}
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, "{\n  \"version\": %d,\n  %s\"maps\": [", ModelVersion, header)
+	for i, name := range names {
+		data, err := json.MarshalIndent(maps[name].modelJSON(), "    ", "  ")
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString("\n    ")
+		b.Write(data)
+	}
+	if len(names) > 0 {
+		b.WriteString("\n  ")
+	}
+	b.WriteString("]")
+	if unplaced != nil {
+		data, err := json.MarshalIndent(unplaced, "  ", "  ")
+		if err != nil {
+			return err
+		}
+		b.WriteString(",\n  \"unplaced\": ")
+		b.Write(data)
+	}
+	b.WriteString("\n}\n")
+	return b.Flush()
+}
+
+// Read a model written by WriteModel, in JSON or JSON Lines. Markers with the same name are shared between the ContigMaps
+// and the contigs, as they are after parsing the inputs, so the maps can be filtered and written again
+func ReadModel(r io.Reader) (map[string]*ContigMap, []string, error) {
+	maps, names, _, err := readModel(r)
+	return maps, names, err
+}
+
+// Read a snapshot written by WriteSnapshot. It returns the ContigMaps and all the contigs by name, placed or not,
+// as they are after parsing and completing the contigs
+func ReadSnapshot(r io.Reader) (map[string]*ContigMap, []string, map[string]*Contig, error) {
+	maps, names, unplaced, err := readModel(r)
+	contigs := make(map[string]*Contig)
+	if err != nil {
+		return maps, names, contigs, err
+	}
+	if unplaced == nil {
+		return maps, names, contigs, fmt.Errorf("no unplaced contigs, this is a model and not a snapshot")
+	}
+	for _, name := range names {
+		for _, c := range *maps[name].Contigs {
+			contigs[c.Name] = c
+		}
+	}
+	for _, c := range unplaced {
+		if _, ok := contigs[c.Name]; ok {
+			return maps, names, contigs, fmt.Errorf("contig %s found twice", c.Name)
+		}
+		contigs[c.Name] = c
+	}
+	return maps, names, contigs, nil
+}
+
+// Read the model and the unplaced contigs of a snapshot, which are nil if there are none in the input
+func readModel(r io.Reader) (out map[string]*ContigMap, names []string, unplaced []*Contig, err error) {
+	out = make(map[string]*ContigMap)
+	markers := make(map[string]*Marker)
+	marker := func(mj markerJSON) (*Marker, error) {
+		m, ok := markers[mj.Name]
+		if !ok {
+			m = &Marker{mj.Name, mj.ConPos, mj.GenPos, mj.Weight, mj.LG, mj.Contig}
+			markers[mj.Name] = m
+		} else if *m != (Marker{mj.Name, mj.ConPos, mj.GenPos, mj.Weight, mj.LG, mj.Contig}) {
+			return nil, fmt.Errorf("marker %s found twice with different values", mj.Name)
+		}
+		return m, nil
+	}
+	contig := func(cj contigModelJSON) (*Contig, error) {
+		c := NewContig()
+		c.Name, c.LG, c.GenPos, c.AvgWeight, c.Orientation, c.OrientSource = cj.Name, cj.LG, cj.GenPos, cj.AvgWeight, cj.Orientation, cj.OrientSource
+		c.Placeable, c.Reason, c.Length, c.BinRank, c.RefPlaced = cj.Placeable, cj.Reason, cj.Length, cj.BinRank, cj.RefPlaced
+		for _, mj := range cj.Markers {
+			m, err := marker(mj)
+			if err != nil {
+				return nil, err
+			}
+			c.AddMarkers(m)
+		}
+		switch len(cj.Range) {
+		case 0:
+		case 2:
+			for i, rj := range cj.Range {
+				if m, ok := (*c.Markers)[rj.Marker]; ok && rj.Marker != "" {
+					c.Range[i] = m
+				} else {
+					c.Range[i] = &Marker{GenPos: rj.GenPos, Weight: rj.Weight}
+				}
+			}
+		default:
+			return nil, fmt.Errorf("contig %s: the range needs 2 ends, found %d", cj.Name, len(cj.Range))
+		}
+		return c, nil
+	}
+	dec := json.NewDecoder(r)
+	for {
+		// Each value is either the whole model, the header or a ContigMap of JSON Lines
+		var v struct {
+			mapModelJSON
+			Header   *RunHeader        `json:"header"`
+			Version  int               `json:"version"`
+			Maps     []mapModelJSON    `json:"maps"`
+			Unplaced []contigModelJSON `json:"unplaced"`
+		}
+		err = dec.Decode(&v)
+		if err == io.EOF && len(names) == 0 {
+			return out, names, unplaced, fmt.Errorf("no LG found in the model")
+		}
+		if err == io.EOF {
+			return out, names, unplaced, nil
+		}
+		if err != nil {
+			return
+		}
+		if v.Version > ModelVersion {
+			return out, names, unplaced, fmt.Errorf("model version %d is newer than the supported %d", v.Version, ModelVersion)
+		}
+		if v.Maps == nil && v.Name == "" && v.Header != nil {
+			continue
+		}
+		lgs := v.Maps
+		if v.Maps == nil {
+			lgs = []mapModelJSON{v.mapModelJSON}
+		}
+		for _, lg := range lgs {
+			if _, ok := out[lg.Name]; ok {
+				return out, names, unplaced, fmt.Errorf("LG %s found twice", lg.Name)
+			}
+			CM := NewContigMap()
+			CM.Name, CM.Filtered, CM.Deleted = lg.Name, lg.Filtered, lg.Deleted
+			for _, mj := range lg.Markers {
+				m, err := marker(mj)
+				if err != nil {
+					return out, names, unplaced, err
+				}
+				CM.AddMarkers(m)
+			}
+			for _, cj := range lg.Contigs {
+				if _, ok := (*CM.Contigs)[cj.Name]; ok {
+					return out, names, unplaced, fmt.Errorf("contig %s found twice in LG %s", cj.Name, lg.Name)
+				}
+				c, err := contig(cj)
+				if err != nil {
+					return out, names, unplaced, err
+				}
+				if c.Range[0] == nil && !CM.Filtered {
+					return out, names, unplaced, fmt.Errorf("contig %s has no range and cannot be filtered", cj.Name)
+				}
+				CM.AddContigs(c)
+			}
+			for _, a := range lg.Adjacencies {
+				CM.Adjacencies = append(CM.Adjacencies, Adjacency{a.Before, a.After, a.Source})
+			}
+			out[lg.Name] = CM
+			names = append(names, lg.Name)
+		}
+		if v.Unplaced != nil && unplaced == nil {
+			unplaced = []*Contig{}
+		}
+		for _, cj := range v.Unplaced {
+			c, err := contig(cj)
+			if err != nil {
+				return out, names, unplaced, err
+			}
+			unplaced = append(unplaced, c)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package ContigMapping
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Struct with the best alignment of a contig (query) against a reference sequence (target) in a PAF file
+type Alignment struct {
+	Query     string
+	QueryLen  uint64
+	Target    string
+	TargetLen uint64
+	Start     uint64
+	End       uint64
+	Strand    string
+	Matches   uint64
+	MapQ      uint64
+}
+
+// Read a PAF file and keep, for each query, the alignment with most matching bases.
+// Alignments with a mapping quality lower than minQ are ignored
+func ReadPAF(r io.Reader, minQ uint64) (map[string]*Alignment, error) {
+	out := make(map[string]*Alignment)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if scanner.Text() == "" {
+			continue
+		}
+		values := strings.Split(scanner.Text(), "\t")
+		if len(values) < 12 {
+			return out, fmt.Errorf("line %d: PAF needs 12 columns, found %d", line, len(values))
+		}
+		var n [7]uint64
+		for i, col := range []int{1, 6, 7, 8, 9, 11, 2} {
+			v, err := strconv.ParseUint(values[col], 10, 64)
+			if err != nil {
+				return out, fmt.Errorf("line %d: %v", line, err)
+			}
+			n[i] = v
+		}
+		if n[5] < minQ {
+			continue
+		}
+		a := &Alignment{Query: values[0], QueryLen: n[0], Target: values[5], TargetLen: n[1], Start: n[2], End: n[3], Strand: values[4], Matches: n[4], MapQ: n[5]}
+		if b, ok := out[a.Query]; !ok || a.Matches > b.Matches {
+			out[a.Query] = a
+		}
+	}
+	return out, scanner.Err()
+}
@@ -0,0 +1,221 @@
+package ContigMapping
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"sort"
+)
+
+// Colours used for the contigs in the plots, in turn
+var palette = []string{"#1f77b4", "#ff7f0e", "#2ca02c", "#9467bd", "#8c564b", "#e377c2", "#7f7f7f", "#bcbd22", "#17becf"}
+
+// Colour for the outlier markers
+const outlierColour = "#d62728"
+
+// Markers sorted by name, so that the plots are always drawn the same
+func sortedMarkers(markers *map[string]*Marker) (out []*Marker) {
+	for _, m := range *markers {
+		out = append(out, m)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Start (0-based) of each contig of the ordered map in the pseudomolecule, and the length of the pseudomolecule.
+// Contigs without a known length use the position of their last marker
+func (CM *ContigMap) Layout(gaps []Gap) (starts map[string]uint64, total uint64) {
+	starts = make(map[string]uint64)
+	CM.Filter()
+	for _, p := range CM.Placements(gaps) {
+		starts[p.Contig] = p.Start
+		total = p.Start + (*CM.Contigs)[p.Contig].length() + p.Gap.Size
+	}
+	return starts, total
+}
+
+// Check if the marker falls more than tolerance cM outside the range of its contig
+func (c *Contig) IsOutlier(m *Marker, tolerance float64) bool {
+	return m.GenPos < c.Range[0].GenPos-tolerance || m.GenPos > c.Range[1].GenPos+tolerance
+}
+
+// Write a Marey plot of the ordered map in SVG: the genetic position of each marker against its position in the pseudomolecule.
+// Contigs are drawn as coloured segments under the plot and their markers in the same colour. Markers of the LG that fall
+// more than tolerance cM outside the range of their contig are highlighted as outliers. The header of the run is written
+// as a comment
+func (CM *ContigMap) WriteMarey(w io.Writer, gaps []Gap, tolerance float64, h *RunHeader) error {
+	const width, height, left, right, top, bottom = 800.0, 600.0, 70.0, 20.0, 40.0, 70.0
+	contigs := CM.Ordered()
+	starts, total := CM.Layout(gaps)
+	minG, maxG := math.Inf(1), math.Inf(-1)
+	for _, m := range *CM.Markers {
+		minG, maxG = math.Min(minG, m.GenPos), math.Max(maxG, m.GenPos)
+	}
+	if len(*CM.Markers) == 0 || maxG == minG {
+		minG, maxG = 0, math.Max(maxG, 1)
+	}
+	if total == 0 {
+		total = 1
+	}
+	x := func(p float64) float64 {
+		return left + p/float64(total)*(width-left-right)
+	}
+	y := func(g float64) float64 {
+		return height - bottom - (g-minG)/(maxG-minG)*(height-top-bottom)
+	}
+	unit, scale := "Mb", 1e6
+	switch {
+	case total < 10000:
+		unit, scale = "bp", 1
+	case total < 10000000:
+		unit, scale = "kb", 1e3
+	}
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, `<svg xmlns="http://www.w3.org/2000/svg" width="%g" height="%g" font-family="sans-serif" font-size="12">`+"\n", width, height)
+	b.WriteString(h.xml())
+	fmt.Fprintf(b, `<text x="%g" y="20" text-anchor="middle" font-size="14">LG %s</text>`+"\n", width/2, html.EscapeString(CM.Name))
+	fmt.Fprintf(b, `<line x1="%g" y1="%g" x2="%g" y2="%g" stroke="black"/>`+"\n", left, height-bottom, width-right, height-bottom)
+	fmt.Fprintf(b, `<line x1="%g" y1="%g" x2="%g" y2="%g" stroke="black"/>`+"\n", left, top, left, height-bottom)
+	for i := 0; i <= 5; i++ {
+		g := minG + float64(i)*(maxG-minG)/5
+		p := float64(i) * float64(total) / 5
+		fmt.Fprintf(b, `<text x="%g" y="%.2f" text-anchor="end">%s</text>`+"\n", left-5, y(g)+4, FormatPos(g))
+		fmt.Fprintf(b, `<text x="%.2f" y="%g" text-anchor="middle">%.4g</text>`+"\n", x(p), height-bottom+35, p/scale)
+	}
+	fmt.Fprintf(b, `<text x="%g" y="%g" text-anchor="middle">Pseudomolecule position (%s)</text>`+"\n", width/2, height-10, unit)
+	fmt.Fprintf(b, `<text x="15" y="%g" text-anchor="middle" transform="rotate(-90 15 %g)">Genetic position (cM)</text>`+"\n", height/2, height/2)
+	for i, c := range contigs {
+		colour := palette[i%len(palette)]
+		start := starts[c.Name]
+		fmt.Fprintf(b, `<line x1="%.2f" y1="%g" x2="%.2f" y2="%g" stroke="%s" stroke-width="6"><title>%s %s</title></line>`+"\n",
+			x(float64(start)), height-bottom+12, x(float64(start+c.length())), height-bottom+12, colour, html.EscapeString(c.Name), c.Orientation)
+		for _, m := range sortedMarkers(c.Markers) {
+			if m.LG != CM.Name {
+				continue
+			}
+			px, py := x(c.pseudoPos(start, m.ConPos)), y(m.GenPos)
+			title := html.EscapeString(m.Name) + " " + FormatPos(m.GenPos)
+			if c.IsOutlier(m, tolerance) {
+				fmt.Fprintf(b, `<circle cx="%.2f" cy="%.2f" r="5" fill="none" stroke="%s" stroke-width="2"><title>outlier %s</title></circle>`+"\n", px, py, outlierColour, title)
+				continue
+			}
+			fmt.Fprintf(b, `<circle cx="%.2f" cy="%.2f" r="2.5" fill="%s"><title>%s</title></circle>`+"\n", px, py, colour, title)
+		}
+	}
+	b.WriteString("</svg>\n")
+	return b.Flush()
+}
+
+// Colours of the contigs in the ideograms by orientation
+var orientColours = map[string]string{"+": "#2ca02c", "-": "#1f77b4", "": "#7f7f7f"}
+
+// Maximum number of lanes of contigs drawn next to each LG
+const maxLanes = 12
+
+// Assign each contig to the first lane where it does not overlap the previous contig, so that contigs sharing
+// genetic positions are drawn side by side. When all the lanes are taken the contig goes in the one that ends first.
+// Returns the lane of each contig and the number of lanes
+func lanes(contigs []*Contig, minHeight float64) (out []int, n int) {
+	var ends []float64
+	for _, c := range contigs {
+		lane := 0
+		for lane < len(ends) && c.Range[0].GenPos <= ends[lane] {
+			lane++
+		}
+		switch {
+		case lane == len(ends) && lane < maxLanes:
+			ends = append(ends, 0)
+		case lane == len(ends):
+			lane = 0
+			for i, e := range ends {
+				if e < ends[lane] {
+					lane = i
+				}
+			}
+		}
+		ends[lane] = math.Max(c.Range[1].GenPos, c.Range[0].GenPos+minHeight)
+		out = append(out, lane)
+	}
+	return out, len(ends)
+}
+
+// Write a MapChart-like ideogram of the maps in SVG, one panel per LG side by side on the same scale. Each LG is a
+// vertical bar in cM with its markers as ticks on the left and its placed contigs as boxes on the right,
+// coloured by orientation. The maps are filtered if they were not already. The header of the run is written as a comment
+func WriteIdeogram(w io.Writer, maps []*ContigMap, h *RunHeader) error {
+	const top, bottom, barWidth, laneWidth, scaleHeight = 50.0, 50.0, 12.0, 14.0, 600.0
+	var maxG float64
+	for _, CM := range maps {
+		for _, m := range *CM.Markers {
+			maxG = math.Max(maxG, m.GenPos)
+		}
+	}
+	if maxG == 0 {
+		maxG = 1
+	}
+	y := func(g float64) float64 {
+		return top + g/maxG*scaleHeight
+	}
+	// Boxes are at least 2 pixels high, which in cM is
+	minHeight := 2 * maxG / scaleHeight
+	// Lay out the panels first, as the width of the figure goes in its header
+	type panel struct {
+		contigs []*Contig
+		lane    []int
+		bar     float64
+	}
+	var panels []panel
+	left := 60.0
+	for _, CM := range maps {
+		contigs := CM.Ordered()
+		lane, n := lanes(contigs, minHeight)
+		panels = append(panels, panel{contigs, lane, left + 20})
+		left += 20 + barWidth + 4 + float64(n)*laneWidth + 30
+	}
+	width, height := math.Max(left, 300), top+scaleHeight+bottom
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, `<svg xmlns="http://www.w3.org/2000/svg" width="%g" height="%g" font-family="sans-serif" font-size="12">`+"\n", width, height)
+	b.WriteString(h.xml())
+	// Scale in cM on the left
+	fmt.Fprintf(b, `<line x1="40" y1="%g" x2="40" y2="%g" stroke="black"/>`+"\n", y(0), y(maxG))
+	for i := 0; i <= 5; i++ {
+		g := float64(i) * maxG / 5
+		fmt.Fprintf(b, `<text x="35" y="%.2f" text-anchor="end" font-size="10">%s</text>`+"\n", y(g)+4, FormatPos(g))
+	}
+	fmt.Fprintf(b, `<text x="40" y="%g" text-anchor="middle">cM</text>`+"\n", top-20)
+	// Legend of the orientations
+	for i, o := range []string{"+", "-", ""} {
+		label := o
+		if o == "" {
+			label = "unknown"
+		}
+		x := 40 + float64(i)*80
+		fmt.Fprintf(b, `<rect x="%g" y="%g" width="12" height="12" fill="%s"/><text x="%g" y="%g">%s</text>`+"\n", x, height-30, orientColours[o], x+16, height-20, label)
+	}
+	for k, CM := range maps {
+		p := panels[k]
+		minM, maxM := math.Inf(1), math.Inf(-1)
+		for _, m := range *CM.Markers {
+			minM, maxM = math.Min(minM, m.GenPos), math.Max(maxM, m.GenPos)
+		}
+		if len(*CM.Markers) == 0 {
+			minM, maxM = 0, 0
+		}
+		fmt.Fprintf(b, `<text x="%g" y="%g" text-anchor="middle" font-size="14">%s</text>`+"\n", p.bar+barWidth/2, top-20, html.EscapeString(CM.Name))
+		fmt.Fprintf(b, `<rect x="%g" y="%.2f" width="%g" height="%.2f" rx="6" fill="#eeeeee" stroke="black"/>`+"\n", p.bar, y(minM), barWidth, y(maxM)-y(minM))
+		for _, m := range sortedMarkers(CM.Markers) {
+			fmt.Fprintf(b, `<line x1="%g" y1="%.2f" x2="%g" y2="%.2f" stroke="black"><title>%s %s</title></line>`+"\n",
+				p.bar-8, y(m.GenPos), p.bar, y(m.GenPos), html.EscapeString(m.Name), FormatPos(m.GenPos))
+		}
+		for i, c := range p.contigs {
+			g0, g1 := c.Range[0].GenPos, math.Max(c.Range[1].GenPos, c.Range[0].GenPos+minHeight)
+			fmt.Fprintf(b, `<rect x="%g" y="%.2f" width="%g" height="%.2f" fill="%s" stroke="black" stroke-width="0.5"><title>%s %s-%s %s</title></rect>`+"\n",
+				p.bar+barWidth+4+float64(p.lane[i])*laneWidth, y(g0), laneWidth-2, y(g1)-y(g0), orientColours[c.Orientation],
+				html.EscapeString(c.Name), FormatPos(c.Range[0].GenPos), FormatPos(c.Range[1].GenPos), c.Orientation)
+		}
+	}
+	b.WriteString("</svg>\n")
+	return b.Flush()
+}
@@ -0,0 +1,137 @@
+package ContigMapping
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Read the contig lengths from a fasta index (.fai) or any tab separated file with the name and the length in the first two columns
+func ReadLengths(r io.Reader) (map[string]uint64, error) {
+	out := make(map[string]uint64)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if scanner.Text() == "" || strings.HasPrefix(scanner.Text(), "#") {
+			continue
+		}
+		values := strings.Split(scanner.Text(), "\t")
+		if len(values) < 2 {
+			return out, fmt.Errorf("wrong number of columns in length line: %q", scanner.Text())
+		}
+		l, err := strconv.ParseUint(values[1], 10, 64)
+		if err != nil {
+			return out, err
+		}
+		out[values[0]] = l
+	}
+	return out, scanner.Err()
+}
+
+// Return the reverse complement of a DNA sequence
+func ReverseComplement(seq []byte) []byte {
+	comp := map[byte]byte{'A': 'T', 'C': 'G', 'G': 'C', 'T': 'A', 'a': 't', 'c': 'g', 'g': 'c', 't': 'a', 'N': 'N', 'n': 'n'}
+	out := make([]byte, len(seq))
+	for i, b := range seq {
+		r, ok := comp[b]
+		if !ok {
+			r = 'N'
+		}
+		out[len(seq)-1-i] = r
+	}
+	return out
+}
+
+// Translate the source of an adjacency into the AGP linkage evidence. The genetic map is always part of the evidence
+func agpEvidence(source string) string {
+	switch source {
+	case "reference":
+		return MapSource + ";align_genus"
+	case "hic":
+		return MapSource + ";proximity_ligation"
+	case "barcodes":
+		return MapSource + ";unspecified"
+	}
+	return MapSource
+}
+
+// Write the ordered ContigMap in AGP 2.0 format, without the version line. Contig lengths must be set.
+// Estimated gaps are written as N gaps, the others as U gaps of UnknownGap bp. Contigs without orientation get "?"
+func (CM *ContigMap) WriteAGP(w io.Writer, gaps []Gap) error {
+	CM.Filter()
+	out := &agpWriter{bufio.NewWriter(w)}
+	if err := out.WriteLG(CM.Name, CM.Deleted, CM.Placements(gaps)); err != nil {
+		return err
+	}
+	return out.Finish()
+}
+
+// Writer of a sequence in lines of width characters. The column is carried from one piece of the sequence to the next
+type lineWriter struct {
+	b          *bufio.Writer
+	width, col int
+}
+
+func (l *lineWriter) Write(seq []byte) (int, error) {
+	n := len(seq)
+	for len(seq) > 0 {
+		k := l.width - l.col
+		if k > len(seq) {
+			k = len(seq)
+		}
+		l.b.Write(seq[:k])
+		seq = seq[k:]
+		if l.col += k; l.col == l.width {
+			l.b.WriteByte('\n')
+			l.col = 0
+		}
+	}
+	return n, nil
+}
+
+// Write n times the base
+func (l *lineWriter) repeat(base byte, n uint64) {
+	chunk := bytes.Repeat([]byte{base}, l.width)
+	for n > 0 {
+		k := uint64(l.width - l.col)
+		if k > n {
+			k = n
+		}
+		l.Write(chunk[:k])
+		n -= k
+	}
+}
+
+// End the last line
+func (l *lineWriter) end() error {
+	if l.col > 0 {
+		l.b.WriteByte('\n')
+		l.col = 0
+	}
+	return l.b.Flush()
+}
+
+// Write the pseudomolecule of the ordered ContigMap in fasta format, with lines of width characters.
+// Contigs with "-" orientation are reverse complemented and gaps are filled with N. The sequences are copied from the
+// fasta file as they are written
+func (CM *ContigMap) WriteFasta(w io.Writer, seqs *Fasta, gaps []Gap, width int) error {
+	contigs := CM.Ordered()
+	out := &lineWriter{b: bufio.NewWriter(w), width: width}
+	out.b.WriteString(">" + CM.Name + "\n")
+	for i, c := range contigs {
+		if err := seqs.copySequence(out, c.Name, c.Orientation == "-"); err != nil {
+			return err
+		}
+		if i == len(contigs)-1 {
+			break
+		}
+		g := Gap{Size: UnknownGap}
+		if i < len(gaps) {
+			g = gaps[i]
+		}
+		out.repeat('N', g.Size)
+	}
+	return out.end()
+}
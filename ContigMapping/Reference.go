@@ -0,0 +1,111 @@
+package ContigMapping
+
+import (
+	"sort"
+)
+
+// Struct with a contig of the map and its alignment to the reference
+type anchor struct {
+	contig *Contig
+	aln    *Alignment
+}
+
+// Place the contigs without markers between map-anchored neighbours using their alignment to a related reference genome.
+// Each LG is assigned to the reference sequence where most of its contigs align. A contig aligned to that sequence is placed when
+// it falls between two anchors that are collinear with the map, and it gets a genetic position interpolated between them.
+// Contigs in markerContigs (those with markers) are never placed, so map-based placement is never overridden.
+// Orientation comes from the alignment strand, flipped when the LG runs in the opposite direction to the reference.
+// The placed contigs are flagged with RefPlaced and returned
+func PlaceByReference(maps map[string]*ContigMap, alignments map[string]*Alignment, markerContigs map[string]*Contig) (out []*Contig) {
+	anchors := make(map[string][]anchor)
+	lgTarget := make(map[string]string)
+	for name, CM := range maps {
+		targets := make(map[string][]anchor)
+		for _, c := range CM.Ordered() {
+			if a, ok := alignments[c.Name]; ok {
+				targets[a.Target] = append(targets[a.Target], anchor{c, a})
+			}
+		}
+		best := ""
+		for t, a := range targets {
+			if len(a) > len(targets[best]) || (len(a) == len(targets[best]) && t < best) {
+				best = t
+			}
+		}
+		// A reference sequence is assigned to the LG with most anchors on it
+		if len(targets[best]) < 2 || len(targets[best]) < len(anchors[best]) {
+			continue
+		}
+		if len(targets[best]) == len(anchors[best]) && name > lgTarget[best] {
+			continue
+		}
+		a := targets[best]
+		sort.Slice(a, func(i, j int) bool { return a[i].aln.Start < a[j].aln.Start })
+		anchors[best] = a
+		lgTarget[best] = name
+	}
+
+	// Sort the names so that the placement does not depend on the iteration order of the map
+	var names []string
+	for name := range alignments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		aln := alignments[name]
+		if _, ok := markerContigs[name]; ok {
+			continue
+		}
+		a, ok := anchors[aln.Target]
+		if !ok {
+			continue
+		}
+		i := sort.Search(len(a), func(i int) bool { return a[i].aln.Start > aln.Start })
+		if i == 0 || i == len(a) {
+			continue
+		}
+		prev, next := a[i-1], a[i]
+		if !collinear(a, i-1) {
+			continue
+		}
+		CM := maps[lgTarget[aln.Target]]
+		c := NewContig()
+		c.Name = name
+		c.LG = CM.Name
+		c.Length = aln.QueryLen
+		c.RefPlaced = true
+		f := float64(aln.Start-prev.aln.Start) / float64(next.aln.Start-prev.aln.Start)
+		c.GenPos = Round(prev.contig.GenPos + f*(next.contig.GenPos-prev.contig.GenPos))
+		p := Marker{GenPos: c.GenPos}
+		c.Range = [2]*Marker{&p, &p}
+		c.Orientation = aln.Strand
+		if direction(a) < 0 {
+			c.Orientation = map[string]string{"+": "-", "-": "+"}[aln.Strand]
+		}
+		c.OrientSource = "reference"
+		CM.AddContigs(c)
+		out = append(out, c)
+	}
+	return out
+}
+
+// Direction of the genetic map along the reference: 1 if the positions increase with the reference coordinates, -1 otherwise
+func direction(a []anchor) int {
+	var d float64
+	for i := 0; i < len(a)-1; i++ {
+		d += a[i+1].contig.GenPos - a[i].contig.GenPos
+	}
+	if d < 0 {
+		return -1
+	}
+	return 1
+}
+
+// Check that the anchors i and i+1 follow the direction of the map along the reference
+func collinear(a []anchor, i int) bool {
+	d := a[i+1].contig.GenPos - a[i].contig.GenPos
+	if direction(a) < 0 {
+		return d <= 0
+	}
+	return d >= 0
+}
@@ -0,0 +1,236 @@
+package ContigMapping
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Read a placement result written by WriteMap. It returns the ContigMaps by LG name and the LG names in the order of the file.
+// The contigs keep the order of the file, have no markers and their Range is their genetic position
+func ReadResult(r io.Reader) (map[string]*ContigMap, []string, error) {
+	out := make(map[string]*ContigMap)
+	var names []string
+	var CM *ContigMap
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		switch {
+		case text == "":
+			continue
+		case strings.HasPrefix(text, "### LG: "):
+			name := strings.TrimPrefix(text, "### LG: ")
+			if _, ok := out[name]; ok {
+				return out, names, fmt.Errorf("line %d: LG %s found twice", line, name)
+			}
+			CM, names = addResultLG(out, names, name)
+		case strings.HasPrefix(text, "### Deleted Sequences: "):
+			if CM == nil {
+				return out, names, fmt.Errorf("line %d: deleted sequences before any LG", line)
+			}
+			d, err := strconv.Atoi(strings.TrimPrefix(text, "### Deleted Sequences: "))
+			if err != nil {
+				return out, names, fmt.Errorf("line %d: %v", line, err)
+			}
+			CM.Deleted = d
+		case strings.HasPrefix(text, "#"):
+			continue
+		default:
+			if CM == nil {
+				return out, names, fmt.Errorf("line %d: contig before any LG", line)
+			}
+			values := strings.Split(text, "\t")
+			if len(values) < 3 {
+				return out, names, fmt.Errorf("line %d: result needs 3 columns, found %d", line, len(values))
+			}
+			pos, err := strconv.ParseFloat(values[1], 64)
+			if err != nil {
+				return out, names, fmt.Errorf("line %d: %v", line, err)
+			}
+			if math.IsNaN(pos) || math.IsInf(pos, 0) {
+				return out, names, fmt.Errorf("line %d: wrong position %s", line, values[1])
+			}
+			addResultContig(CM, values[0], pos, values[2], len(values) > 3 && values[3] == "reference")
+		}
+	}
+	return out, names, scanner.Err()
+}
+
+// Placement result in JSON: the LGs in order, each with its contigs in order
+type resultJSON struct {
+	LGs []lgJSON `json:"lgs"`
+}
+
+type lgJSON struct {
+	Name    string       `json:"name"`
+	Deleted int          `json:"deleted"`
+	Contigs []contigJSON `json:"contigs"`
+}
+
+type contigJSON struct {
+	Name        string  `json:"name"`
+	Position    float64 `json:"position"`
+	Orientation string  `json:"orientation"`
+	Reference   bool    `json:"reference,omitempty"`
+	Length      uint64  `json:"length,omitempty"`
+}
+
+// Add a contig read from a result file to the map, keeping the order of the file
+func addResultContig(CM *ContigMap, name string, pos float64, orientation string, reference bool) {
+	c := NewContig()
+	c.Name = name
+	c.LG = CM.Name
+	c.GenPos = pos
+	c.Orientation = orientation
+	c.RefPlaced = reference
+	c.BinRank = len(*CM.Contigs)
+	p := Marker{GenPos: pos}
+	c.Range = [2]*Marker{&p, &p}
+	CM.AddContigs(c)
+}
+
+// Add an empty, already filtered LG to the maps read from a result file
+func addResultLG(out map[string]*ContigMap, names []string, name string) (*ContigMap, []string) {
+	CM := NewContigMap()
+	CM.Name = name
+	CM.Filtered = true
+	out[name] = CM
+	return CM, append(names, name)
+}
+
+// Write the ContigMaps in JSON, with the LGs in the order of names
+func WriteResultJSON(w io.Writer, maps map[string]*ContigMap, names []string) error {
+	out, _ := NewWriter("json", w, nil)
+	for _, name := range names {
+		CM := maps[name]
+		CM.Filter()
+		if err := out.WriteLG(name, CM.Deleted, CM.Placements(nil)); err != nil {
+			return err
+		}
+	}
+	return out.Finish()
+}
+
+// Read a placement result written by WriteResultJSON
+func ReadResultJSON(r io.Reader) (map[string]*ContigMap, []string, error) {
+	out := make(map[string]*ContigMap)
+	var names []string
+	var res resultJSON
+	if err := json.NewDecoder(r).Decode(&res); err != nil {
+		return out, names, err
+	}
+	for _, lg := range res.LGs {
+		if _, ok := out[lg.Name]; ok {
+			return out, names, fmt.Errorf("LG %s found twice", lg.Name)
+		}
+		var CM *ContigMap
+		CM, names = addResultLG(out, names, lg.Name)
+		CM.Deleted = lg.Deleted
+		for _, c := range lg.Contigs {
+			addResultContig(CM, c.Name, c.Position, c.Orientation, c.Reference)
+			(*CM.Contigs)[c.Name].Length = c.Length
+		}
+	}
+	return out, names, nil
+}
+
+// Read the order of the contigs from an AGP file. Each object is a LG. AGP has no genetic positions, so every contig
+// is at 0 cM and keeps the order of the file. Orientations other than + and - are read as unknown
+func ReadAGP(r io.Reader) (map[string]*ContigMap, []string, error) {
+	out := make(map[string]*ContigMap)
+	var names []string
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		values := strings.Split(text, "\t")
+		if len(values) < 9 {
+			return out, names, fmt.Errorf("line %d: AGP needs 9 columns, found %d", line, len(values))
+		}
+		if values[4] == "N" || values[4] == "U" {
+			continue
+		}
+		CM, ok := out[values[0]]
+		if !ok {
+			CM, names = addResultLG(out, names, values[0])
+		}
+		o := values[8]
+		if o != "+" && o != "-" {
+			o = ""
+		}
+		addResultContig(CM, values[5], 0, o, false)
+	}
+	return out, names, scanner.Err()
+}
+
+// Check if the JSON placement in r is a result of WriteResultJSON, where the first member after the header is "lgs",
+// and not a model
+func isResultJSON(r io.Reader) (bool, error) {
+	dec := json.NewDecoder(r)
+	if _, err := dec.Token(); err != nil {
+		return false, err
+	}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return false, err
+		}
+		if key != "header" {
+			return key == "lgs", nil
+		}
+		var header json.RawMessage
+		if err := dec.Decode(&header); err != nil {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// Read a placement result in any of the formats: the format of WriteMap, AGP, JSON or the model of WriteModel. The format
+// is detected from the content: JSON starts with "{" and its first member after the header is "lgs" while in the model it
+// is not, and AGP has the "##agp-version" header or 9 columns or more
+func ReadAnyResult(r io.Reader) (map[string]*ContigMap, []string, error) {
+	b := bufio.NewReader(r)
+	for {
+		start, err := b.Peek(1)
+		if err != nil {
+			return ReadResult(b)
+		}
+		if start[0] != ' ' && start[0] != '\t' && start[0] != '\n' && start[0] != '\r' {
+			break
+		}
+		b.ReadByte()
+	}
+	head, _ := b.Peek(4096)
+	first := head
+	if i := bytes.IndexByte(head, '\n'); i >= 0 {
+		first = head[:i]
+	}
+	switch {
+	case head[0] == '{':
+		// The header can be of any size, so the part read to find the kind is read again by the reader of the kind
+		var read bytes.Buffer
+		result, err := isResultJSON(io.TeeReader(b, &read))
+		if err != nil {
+			return nil, nil, err
+		}
+		if result {
+			return ReadResultJSON(io.MultiReader(&read, b))
+		}
+		return ReadModel(io.MultiReader(&read, b))
+	case bytes.HasPrefix(head, []byte("##agp-version")), !bytes.HasPrefix(first, []byte("#")) && bytes.Count(first, []byte("\t")) >= 8:
+		return ReadAGP(b)
+	}
+	return ReadResult(b)
+}
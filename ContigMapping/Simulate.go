@@ -0,0 +1,284 @@
+package ContigMapping
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+)
+
+// Recombination landscapes of the simulated chromosomes
+const (
+	LandscapeUniform   = "uniform"   // Constant recombination rate along the chromosome
+	LandscapeTelomeric = "telomeric" // Recombination concentrated at the ends of the chromosome, none in the centre
+)
+
+// Parameters of a simulation
+type SimParams struct {
+	Chromosomes      int     // Number of chromosomes, each one a LG
+	ChromosomeLength uint64  // Length of each chromosome (bp)
+	ContigLength     uint64  // Mean length of the contigs (bp)
+	MapLength        float64 // Length of the genetic map of each chromosome (cM)
+	Landscape        string  // Recombination landscape
+	MarkerDensity    float64 // Markers per Mb
+	Individuals      int     // Individuals genotyped. The weight of a marker is the number of them without missing data
+	MissingRate      float64 // Mean fraction of missing data per marker
+	ErrorRate        float64 // Fraction of markers with genotyping errors, placed at a random position of their LG
+	ChimeraRate      float64 // Fraction of contigs joined to a contig of another chromosome
+	MultiMapRate     float64 // Fraction of markers that also hit a random contig
+}
+
+// Default parameters of a simulation: a small genome without errors
+func DefaultSimParams() SimParams {
+	return SimParams{Chromosomes: 5, ChromosomeLength: 20000000, ContigLength: 200000, MapLength: 100, Landscape: LandscapeUniform,
+		MarkerDensity: 20, Individuals: 100, MissingRate: 0.1}
+}
+
+// Part of a chromosome in a simulated contig. A contig has one piece, or two if it is chimeric
+type SimPiece struct {
+	LG     string
+	Start  uint64 // 0-based, included
+	End    uint64 // 0-based, excluded
+	Strand string // "+" if the contig runs in the direction of the genetic map
+}
+
+// Contig of the simulated assembly
+type SimContig struct {
+	Name   string
+	Pieces []SimPiece
+}
+
+// Length of the contig
+func (c *SimContig) Length() (out uint64) {
+	for _, p := range c.Pieces {
+		out += p.End - p.Start
+	}
+	return out
+}
+
+// Position in the contig of a chromosome position in the piece i
+func (c *SimContig) conPos(i int, pos uint64) uint64 {
+	var offset uint64
+	for _, p := range c.Pieces[:i] {
+		offset += p.End - p.Start
+	}
+	p := c.Pieces[i]
+	if p.Strand == "-" {
+		return offset + p.End - 1 - pos
+	}
+	return offset + pos - p.Start
+}
+
+// Hit of a simulated marker on a contig
+type SimHit struct {
+	Contig string
+	ConPos uint64
+}
+
+// Marker of the simulated genetic map
+type SimMarker struct {
+	Name   string
+	LG     string
+	Pos    uint64  // True position in the chromosome
+	GenPos float64 // Position in the genetic map, wrong if Error
+	Error  bool
+	Weight uint64
+	Hits   []SimHit // First the true contig, then the other hits of a multi-mapping marker
+}
+
+// Simulated genome, genetic map and markers
+type Simulation struct {
+	Params  SimParams
+	LGs     []string
+	Contigs []*SimContig
+	Markers []*SimMarker
+}
+
+// Genetic position of a chromosome position under the landscape
+func (p SimParams) cM(pos uint64) float64 {
+	u := float64(pos) / float64(p.ChromosomeLength)
+	if p.Landscape == LandscapeTelomeric {
+		return p.MapLength * (1 + math.Pow(2*u-1, 3)) / 2
+	}
+	return p.MapLength * u
+}
+
+// Number of successes in n trials with probability p
+func binomial(rng *rand.Rand, n int, p float64) (out int) {
+	for i := 0; i < n; i++ {
+		if rng.Float64() < p {
+			out++
+		}
+	}
+	return out
+}
+
+// Check the parameters of a simulation
+func (p SimParams) Check() error {
+	switch {
+	case p.Chromosomes < 1:
+		return fmt.Errorf("the number of chromosomes must be at least 1")
+	case p.ChromosomeLength == 0 || p.ContigLength == 0:
+		return fmt.Errorf("the chromosome and contig lengths must be positive")
+	case p.MapLength <= 0:
+		return fmt.Errorf("the map length must be positive")
+	case p.Landscape != LandscapeUniform && p.Landscape != LandscapeTelomeric:
+		return fmt.Errorf("unknown recombination landscape %s", p.Landscape)
+	case p.MarkerDensity <= 0 || p.Individuals < 1:
+		return fmt.Errorf("the marker density and the number of individuals must be positive")
+	}
+	for _, r := range []float64{p.MissingRate, p.ErrorRate, p.ChimeraRate, p.MultiMapRate} {
+		if r < 0 || r > 1 {
+			return fmt.Errorf("rates must be between 0 and 1")
+		}
+	}
+	return nil
+}
+
+// Simulate a genome of contigs and a genetic map with markers on the contigs. The results depend only on the parameters and rng
+func Simulate(p SimParams, rng *rand.Rand) (*Simulation, error) {
+	if err := p.Check(); err != nil {
+		return nil, err
+	}
+	s := &Simulation{Params: p}
+	// Tile each chromosome with contigs of exponential lengths, with a minimum of a tenth of the mean
+	for i := 1; i <= p.Chromosomes; i++ {
+		lg := "lg" + strconv.Itoa(i)
+		s.LGs = append(s.LGs, lg)
+		for start := uint64(0); start < p.ChromosomeLength; {
+			l := uint64(rng.ExpFloat64()*float64(p.ContigLength)) + p.ContigLength/10 + 1
+			end := start + l
+			if end > p.ChromosomeLength {
+				end = p.ChromosomeLength
+			}
+			strand := "+"
+			if rng.Intn(2) == 1 {
+				strand = "-"
+			}
+			name := "contig" + strconv.Itoa(len(s.Contigs)+1)
+			s.Contigs = append(s.Contigs, &SimContig{Name: name, Pieces: []SimPiece{{lg, start, end, strand}}})
+			start = end
+		}
+	}
+	// Join contigs of different chromosomes into chimeras
+	if p.Chromosomes > 1 {
+		for i := 0; i < len(s.Contigs); i++ {
+			c := s.Contigs[i]
+			if len(c.Pieces) > 1 || rng.Float64() >= p.ChimeraRate {
+				continue
+			}
+			j := rng.Intn(len(s.Contigs))
+			d := s.Contigs[j]
+			if len(d.Pieces) > 1 || d.Pieces[0].LG == c.Pieces[0].LG {
+				continue
+			}
+			c.Pieces = append(c.Pieces, d.Pieces[0])
+			s.Contigs = append(s.Contigs[:j], s.Contigs[j+1:]...)
+			if j < i {
+				i--
+			}
+		}
+	}
+	// Index the pieces by chromosome to find the contig of each marker
+	type located struct {
+		contig *SimContig
+		piece  int
+	}
+	pieces := make(map[string][]located)
+	for _, c := range s.Contigs {
+		for i, piece := range c.Pieces {
+			pieces[piece.LG] = append(pieces[piece.LG], located{c, i})
+		}
+	}
+	for _, lg := range s.LGs {
+		l := pieces[lg]
+		sort.Slice(l, func(i, j int) bool {
+			return l[i].contig.Pieces[l[i].piece].Start < l[j].contig.Pieces[l[j].piece].Start
+		})
+	}
+	n := int(float64(p.ChromosomeLength) / 1e6 * p.MarkerDensity)
+	for _, lg := range s.LGs {
+		var positions []uint64
+		for i := 0; i < n; i++ {
+			positions = append(positions, uint64(rng.Int63n(int64(p.ChromosomeLength))))
+		}
+		sort.Slice(positions, func(i, j int) bool { return positions[i] < positions[j] })
+		l := pieces[lg]
+		for _, pos := range positions {
+			k := sort.Search(len(l), func(k int) bool { return l[k].contig.Pieces[l[k].piece].End > pos })
+			m := &SimMarker{Name: "m" + strconv.Itoa(len(s.Markers)+1), LG: lg, Pos: pos, GenPos: Round(p.cM(pos))}
+			missing := binomial(rng, p.Individuals, math.Min(1, rng.Float64()*2*p.MissingRate))
+			m.Weight = uint64(p.Individuals - missing)
+			if rng.Float64() < p.ErrorRate {
+				m.Error = true
+				m.GenPos = Round(rng.Float64() * p.MapLength)
+			}
+			m.Hits = []SimHit{{l[k].contig.Name, l[k].contig.conPos(l[k].piece, pos)}}
+			if rng.Float64() < p.MultiMapRate {
+				other := s.Contigs[rng.Intn(len(s.Contigs))]
+				m.Hits = append(m.Hits, SimHit{other.Name, uint64(rng.Int63n(int64(other.Length())))})
+			}
+			s.Markers = append(s.Markers, m)
+		}
+	}
+	return s, nil
+}
+
+// Write the genetic map in the format read by place, with the markers of each LG sorted by position
+func (s *Simulation) WriteMap(w io.Writer) error {
+	byLG := make(map[string][]*SimMarker)
+	for _, m := range s.Markers {
+		byLG[m.LG] = append(byLG[m.LG], m)
+	}
+	b := bufio.NewWriter(w)
+	b.WriteString(";simulated genetic map\n")
+	for _, lg := range s.LGs {
+		markers := byLG[lg]
+		sort.SliceStable(markers, func(i, j int) bool { return markers[i].GenPos < markers[j].GenPos })
+		b.WriteString("group " + lg + "\n")
+		for _, m := range markers {
+			b.WriteString(m.Name + "\t" + FormatPos(m.GenPos) + "\n")
+		}
+	}
+	return b.Flush()
+}
+
+// Write the hits of the markers on the contigs in the format read by place
+func (s *Simulation) WriteMarkers(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	for _, m := range s.Markers {
+		for _, h := range m.Hits {
+			fmt.Fprintf(b, "%s\t%s\t%d\t%d\n", m.Name, h.Contig, h.ConPos, m.Weight)
+		}
+	}
+	return b.Flush()
+}
+
+// Write the true placement of the contigs as a table. The position and orientation are those of the first piece.
+// Chimeric contigs have the second piece in the last column, "-" otherwise. Contigs without markers are included
+func (s *Simulation) WriteTruth(w io.Writer) error {
+	markers := make(map[string]int)
+	errors := make(map[string]int)
+	for _, m := range s.Markers {
+		markers[m.Hits[0].Contig]++
+		if m.Error {
+			errors[m.Hits[0].Contig]++
+		}
+	}
+	b := bufio.NewWriter(w)
+	b.WriteString("Contig\tLG\tStart\tEnd\tOrientation\tStartcM\tEndcM\tMarkers\tErrorMarkers\tChimera\n")
+	for _, c := range s.Contigs {
+		p := c.Pieces[0]
+		chimera := "-"
+		if len(c.Pieces) > 1 {
+			q := c.Pieces[1]
+			chimera = fmt.Sprintf("%s:%d-%d%s", q.LG, q.Start+1, q.End, q.Strand)
+		}
+		fmt.Fprintf(b, "%s\t%s\t%d\t%d\t%s\t%s\t%s\t%d\t%d\t%s\n", c.Name, p.LG, p.Start+1, p.End, p.Strand,
+			FormatPos(s.Params.cM(p.Start)), FormatPos(s.Params.cM(p.End-1)), markers[c.Name], errors[c.Name], chimera)
+	}
+	return b.Flush()
+}
@@ -0,0 +1,188 @@
+package ContigMapping
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// Reasons counted in the statistics, in the order of the columns of the table
+var Reasons = []string{ReasonConflictingLG, ReasonConflictingOrientation, ReasonNoMapPosition, ReasonUnknownLG, ReasonExcluded}
+
+// Struct with the summary of a placement for one LG, or for all of them
+type Stats struct {
+	Name          string
+	MapMarkers    int
+	HitMarkers    int
+	Contigs       int
+	Assigned      int
+	Placed        int
+	Oriented      int
+	Unoriented    int
+	Removed       int
+	Unplaceable   map[string]int
+	PlacedLength  uint64
+	N50           uint64
+	LengthsKnown  bool
+	SpanCovered   float64
+	MapSpan       float64
+	placedLengths []uint64
+}
+
+func newStats(name string) *Stats {
+	return &Stats{Name: name, Unplaceable: make(map[string]int), LengthsKnown: true}
+}
+
+// Calculate the N50 of a list of lengths
+func n50(lengths []uint64) uint64 {
+	sorted := append([]uint64(nil), lengths...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] > sorted[j] })
+	var total, sum uint64
+	for _, l := range sorted {
+		total += l
+	}
+	for _, l := range sorted {
+		sum += l
+		if 2*sum >= total {
+			return l
+		}
+	}
+	return 0
+}
+
+// Add the placed contigs of the map to the statistics
+func (s *Stats) addPlaced(CM *ContigMap) {
+	min, max := math.Inf(1), math.Inf(-1)
+	for _, c := range *CM.Contigs {
+		s.Placed++
+		if c.Orientation == "" {
+			s.Unoriented++
+		} else {
+			s.Oriented++
+		}
+		if c.Length == 0 {
+			s.LengthsKnown = false
+		}
+		s.PlacedLength += c.Length
+		s.placedLengths = append(s.placedLengths, c.Length)
+		min, max = math.Min(min, c.Range[0].GenPos), math.Max(max, c.Range[1].GenPos)
+	}
+	if s.Placed > 0 {
+		s.SpanCovered += max - min
+	}
+	s.Removed += CM.Deleted
+	min, max = math.Inf(1), math.Inf(-1)
+	for _, m := range *CM.Markers {
+		s.MapMarkers++
+		if m.Contig != "" {
+			s.HitMarkers++
+		}
+		min, max = math.Min(min, m.GenPos), math.Max(max, m.GenPos)
+	}
+	if len(*CM.Markers) > 0 {
+		s.MapSpan += max - min
+	}
+}
+
+// Add a contig with markers to the statistics of the LG, or of the total if lg is empty. Only placeable contigs are
+// assigned, so that the assigned contigs of the LGs add up to the total
+func (s *Stats) addContig(c *Contig, lg string) {
+	s.Contigs++
+	if c.Placeable && (lg == "" || c.LG == lg) {
+		s.Assigned++
+	}
+	if !c.Placeable {
+		s.Unplaceable[c.Reason]++
+	}
+}
+
+// Summarise the placement per LG and overall. maps must be filtered and contigs has all the contigs with markers.
+// A contig is counted in every LG where it has markers, but only once in the total
+func Summarise(maps map[string]*ContigMap, contigs map[string]*Contig) (out []*Stats, total *Stats) {
+	total = newStats("total")
+	byLG := make(map[string][]*Contig)
+	for _, c := range contigs {
+		seen := make(map[string]bool)
+		for _, m := range *c.Markers {
+			if !seen[m.LG] {
+				seen[m.LG] = true
+				byLG[m.LG] = append(byLG[m.LG], c)
+			}
+		}
+		total.addContig(c, "")
+	}
+	var names []string
+	for name := range maps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		CM := maps[name]
+		if !CM.Filtered {
+			CM.filterContigs()
+		}
+		s := newStats(name)
+		s.addPlaced(CM)
+		total.addPlaced(CM)
+		for _, c := range byLG[name] {
+			s.addContig(c, name)
+		}
+		s.N50 = n50(s.placedLengths)
+		out = append(out, s)
+	}
+	total.N50 = n50(total.placedLengths)
+	return out, total
+}
+
+// Write the statistics as a tab separated table with one line per LG and the total in the last line.
+// Lengths and N50 are "NA" when the lengths of the placed contigs are not known
+func WriteStats(w io.Writer, stats []*Stats, total *Stats) error {
+	head := "LG\tMapMarkers\tHitMarkers\tContigsWithMarkers\tAssigned\tPlaced\tOriented\tUnoriented\tRemoved"
+	for _, r := range Reasons {
+		head += "\tUnplaceable (" + r + ")"
+	}
+	head += "\tPlacedLength\tN50\tSpanCovered\tMapSpan\n"
+	if _, err := io.WriteString(w, head); err != nil {
+		return err
+	}
+	for _, s := range append(stats, total) {
+		line := s.Name
+		for _, n := range []int{s.MapMarkers, s.HitMarkers, s.Contigs, s.Assigned, s.Placed, s.Oriented, s.Unoriented, s.Removed} {
+			line += "\t" + strconv.Itoa(n)
+		}
+		for _, r := range Reasons {
+			line += "\t" + strconv.Itoa(s.Unplaceable[r])
+		}
+		if s.LengthsKnown {
+			line += "\t" + strconv.FormatUint(s.PlacedLength, 10) + "\t" + strconv.FormatUint(s.N50, 10)
+		} else {
+			line += "\tNA\tNA"
+		}
+		line += "\t" + FormatPos(s.SpanCovered) + "\t" + FormatPos(s.MapSpan) + "\n"
+		if _, err := io.WriteString(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Human readable summary of the statistics
+func (s *Stats) Summary() string {
+	out := "Summary for " + s.Name + "\n"
+	out += fmt.Sprintf("\tMarkers in map: %d\n\tMarkers hit on contigs: %d\n", s.MapMarkers, s.HitMarkers)
+	out += fmt.Sprintf("\tContigs with markers: %d\n\tContigs assigned to a LG: %d\n", s.Contigs, s.Assigned)
+	out += fmt.Sprintf("\tContigs placed: %d (%d oriented, %d unoriented)\n", s.Placed, s.Oriented, s.Unoriented)
+	out += fmt.Sprintf("\tContigs removed by filtering: %d\n", s.Removed)
+	for _, r := range Reasons {
+		if s.Unplaceable[r] > 0 {
+			out += fmt.Sprintf("\tUnplaceable contigs (%s): %d\n", r, s.Unplaceable[r])
+		}
+	}
+	if s.LengthsKnown {
+		out += fmt.Sprintf("\tPlaced length: %d bp (N50 %d bp)\n", s.PlacedLength, s.N50)
+	}
+	out += "\tcM covered by placed contigs: " + FormatPos(s.SpanCovered) + " of " + FormatPos(s.MapSpan) + "\n"
+	return out
+}
@@ -0,0 +1,334 @@
+package ContigMapping
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Placement of a contig in the ordered map of its LG
+type Placement struct {
+	LG          string
+	Contig      string
+	GenPos      float64
+	Orientation string
+	Reference   bool   // Placed with the alignment to the reference instead of markers
+	Weight      uint64 // Average weight of the markers of the contig
+	Length      uint64 // 0 if unknown
+	Start       uint64 // 0-based start in the pseudomolecule. Unknown lengths are estimated from the markers
+	Gap         Gap    // Gap to the next contig, with Size 0 after the last one
+	Evidence    string // Source of the adjacency with the next contig
+}
+
+// Length of the contig, or if unknown the position of its last marker plus one
+func (c *Contig) length() uint64 {
+	if c.Length > 0 {
+		return c.Length
+	}
+	var max float64
+	for _, m := range *c.Markers {
+		max = math.Max(max, m.ConPos)
+	}
+	return uint64(max) + 1
+}
+
+// Position of the marker in the pseudomolecule, given the start of its contig there (0-based)
+func (c *Contig) pseudoPos(start uint64, conPos float64) float64 {
+	if c.Orientation == "-" {
+		return float64(start) + float64(c.length()) - 1 - conPos
+	}
+	return float64(start) + conPos
+}
+
+// Return the placements of the contigs of the map sorted by genetic position, without filtering or otherwise changing the map.
+// The positions in the pseudomolecule use the given gaps, or UnknownGap where there are none
+func (CM *ContigMap) Placements(gaps []Gap) []Placement {
+	contigs := CM.sorted()
+	out := make([]Placement, len(contigs))
+	var start uint64
+	for i, c := range contigs {
+		p := Placement{LG: CM.Name, Contig: c.Name, GenPos: c.GenPos, Orientation: c.Orientation, Reference: c.RefPlaced, Weight: c.AvgWeight, Length: c.Length, Start: start}
+		start += c.length()
+		if i < len(contigs)-1 {
+			p.Gap = Gap{Before: c.Name, After: contigs[i+1].Name, Size: UnknownGap}
+			if i < len(gaps) {
+				p.Gap = gaps[i]
+			}
+			p.Evidence = MapSource
+			if i < len(CM.Adjacencies) && CM.Adjacencies[i].Before == c.Name {
+				p.Evidence = CM.Adjacencies[i].Source
+			}
+			start += p.Gap.Size
+		}
+		out[i] = p
+	}
+	return out
+}
+
+// Writer of the placements in one of the output formats. The LGs are written one after the other and Finish completes the output
+type Writer interface {
+	WriteLG(name string, deleted int, placements []Placement) error
+	Finish() error
+}
+
+// Output formats of NewWriter
+var Formats = []string{"map", "tsv", "json", "agp", "bed", "gff3"}
+
+// Check if the format needs the lengths of the contigs
+func NeedsLengths(format string) bool {
+	return format == "agp" || format == "bed" || format == "gff3"
+}
+
+// Create a Writer of the format to w. The header of the run, if not nil, is written as comment lines, or as the
+// "header" object in JSON
+func NewWriter(format string, w io.Writer, h *RunHeader) (Writer, error) {
+	b := bufio.NewWriter(w)
+	switch format {
+	case "map":
+		b.WriteString(h.Comment("##"))
+		return &mapWriter{b}, nil
+	case "tsv":
+		b.WriteString(h.Comment("##") + "LG\tContig\tPosition\tOrientation\n")
+		return &tsvWriter{b}, nil
+	case "json":
+		header, err := h.json("  ")
+		if err != nil {
+			return nil, err
+		}
+		b.WriteString("{\n  " + header + "\"lgs\": [")
+		return &jsonWriter{b: b}, nil
+	case "agp":
+		b.WriteString("##agp-version 2.0\n" + h.Comment("##"))
+		return &agpWriter{b}, nil
+	case "bed":
+		b.WriteString(h.Comment("##"))
+		return &bedWriter{b}, nil
+	case "gff3":
+		// Lines starting with ## are directives in GFF3
+		b.WriteString("##gff-version 3\n" + h.Comment("#"))
+		return &gffWriter{b}, nil
+	}
+	return nil, fmt.Errorf("unknown output format %s, use one of %s", format, strings.Join(Formats, ", "))
+}
+
+// Write a LG in the result format, without the empty line that separates the LGs
+func writeMapLG(b *bufio.Writer, name string, deleted int, placements []Placement) {
+	b.WriteString("### LG: " + name + "\n### Deleted Sequences: " + strconv.Itoa(deleted) + "\n")
+	for _, p := range placements {
+		b.WriteString(p.Contig)
+		b.WriteByte('\t')
+		b.WriteString(FormatPos(p.GenPos))
+		b.WriteByte('\t')
+		b.WriteString(p.Orientation)
+		if p.Reference {
+			b.WriteString("\treference")
+		}
+		b.WriteByte('\n')
+	}
+}
+
+// Result format read by ReadResult
+type mapWriter struct {
+	b *bufio.Writer
+}
+
+func (m *mapWriter) WriteLG(name string, deleted int, placements []Placement) error {
+	writeMapLG(m.b, name, deleted, placements)
+	return m.b.WriteByte('\n')
+}
+
+func (m *mapWriter) Finish() error {
+	return m.b.Flush()
+}
+
+// One line per contig with its LG
+type tsvWriter struct {
+	b *bufio.Writer
+}
+
+func (t *tsvWriter) WriteLG(name string, deleted int, placements []Placement) error {
+	for _, p := range placements {
+		t.b.WriteString(name + "\t" + p.Contig + "\t" + FormatPos(p.GenPos) + "\t" + p.Orientation + "\n")
+	}
+	return nil
+}
+
+func (t *tsvWriter) Finish() error {
+	return t.b.Flush()
+}
+
+// JSON read by ReadResultJSON, one LG after the other
+type jsonWriter struct {
+	b *bufio.Writer
+	n int
+}
+
+func (j *jsonWriter) WriteLG(name string, deleted int, placements []Placement) error {
+	lg := lgJSON{Name: name, Deleted: deleted, Contigs: []contigJSON{}}
+	for _, p := range placements {
+		lg.Contigs = append(lg.Contigs, contigJSON{p.Contig, Round(p.GenPos), p.Orientation, p.Reference, p.Length})
+	}
+	data, err := json.MarshalIndent(lg, "    ", "  ")
+	if err != nil {
+		return err
+	}
+	if j.n > 0 {
+		j.b.WriteByte(',')
+	}
+	j.n++
+	j.b.WriteString("\n    ")
+	_, err = j.b.Write(data)
+	return err
+}
+
+func (j *jsonWriter) Finish() error {
+	if j.n > 0 {
+		j.b.WriteString("\n  ")
+	}
+	j.b.WriteString("]\n}\n")
+	return j.b.Flush()
+}
+
+// AGP 2.0 of the pseudomolecules. Contig lengths must be known.
+// Estimated gaps are written as N gaps, the others as U gaps of UnknownGap bp. Contigs without orientation get "?"
+type agpWriter struct {
+	b *bufio.Writer
+}
+
+func (a *agpWriter) WriteLG(name string, deleted int, placements []Placement) error {
+	var pos uint64 = 1
+	part := 1
+	for i, p := range placements {
+		if p.Length == 0 {
+			return fmt.Errorf("unknown length for contig %s", p.Contig)
+		}
+		o := p.Orientation
+		if o == "" {
+			o = "?"
+		}
+		fmt.Fprintf(a.b, "%s\t%d\t%d\t%d\tW\t%s\t1\t%d\t%s\n", name, pos, pos+p.Length-1, part, p.Contig, p.Length, o)
+		pos += p.Length
+		part++
+		if i == len(placements)-1 {
+			break
+		}
+		t := "U"
+		if p.Gap.Estimated {
+			t = "N"
+		}
+		fmt.Fprintf(a.b, "%s\t%d\t%d\t%d\t%s\t%d\tscaffold\tyes\t%s\n", name, pos, pos+p.Gap.Size-1, part, t, p.Gap.Size, agpEvidence(p.Evidence))
+		pos += p.Gap.Size
+		part++
+	}
+	return nil
+}
+
+func (a *agpWriter) Finish() error {
+	return a.b.Flush()
+}
+
+// BED6 with the position of each contig in the pseudomolecule of its LG. Contig lengths must be known.
+// The score is 0 and the strand is "." for contigs without orientation
+type bedWriter struct {
+	b *bufio.Writer
+}
+
+func (w *bedWriter) WriteLG(name string, deleted int, placements []Placement) error {
+	for _, p := range placements {
+		if p.Length == 0 {
+			return fmt.Errorf("unknown length for contig %s", p.Contig)
+		}
+		strand := p.Orientation
+		if strand == "" {
+			strand = "."
+		}
+		fmt.Fprintf(w.b, "%s\t%d\t%d\t%s\t0\t%s\n", name, p.Start, p.Start+p.Length, p.Contig, strand)
+	}
+	return nil
+}
+
+func (w *bedWriter) Finish() error {
+	return w.b.Flush()
+}
+
+// GFF3 with a contig feature for each contig in the pseudomolecule of its LG. Contig lengths must be known.
+// The attributes have the LG, the genetic position, the average weight of the markers and the orientation ("?" if unknown)
+type gffWriter struct {
+	b *bufio.Writer
+}
+
+// Escape the characters with a special meaning in the GFF3 columns and attributes
+var gffEscaper = strings.NewReplacer("%", "%25", ";", "%3B", "=", "%3D", "&", "%26", ",", "%2C", "\t", "%09", "\n", "%0A")
+
+func (g *gffWriter) WriteLG(name string, deleted int, placements []Placement) error {
+	if len(placements) == 0 {
+		return nil
+	}
+	last := placements[len(placements)-1]
+	fmt.Fprintf(g.b, "##sequence-region %s 1 %d\n", gffEscaper.Replace(name), last.Start+last.Length)
+	for _, p := range placements {
+		if p.Length == 0 {
+			return fmt.Errorf("unknown length for contig %s", p.Contig)
+		}
+		strand, o := p.Orientation, p.Orientation
+		if o == "" {
+			strand, o = ".", "?"
+		}
+		id := gffEscaper.Replace(p.Contig)
+		fmt.Fprintf(g.b, "%s\tContigMapper\tcontig\t%d\t%d\t.\t%s\t.\tID=%s;Name=%s;lg=%s;cM=%s;weight=%d;orientation=%s\n",
+			gffEscaper.Replace(name), p.Start+1, p.Start+p.Length, strand, id, id, gffEscaper.Replace(name), FormatPos(p.GenPos), p.Weight, o)
+	}
+	return nil
+}
+
+func (g *gffWriter) Finish() error {
+	return g.b.Flush()
+}
+
+// Write the markers of the LG on the placed contigs as BED6 in the coordinates of the pseudomolecule, sorted by position.
+// The name is marker:cM, the score is the weight of the marker (at most 1000) and the strand is the orientation of its contig.
+// The markers of other LGs are left out. Contig lengths must be known
+func (CM *ContigMap) WriteMarkerBED(w io.Writer, gaps []Gap) error {
+	CM.Filter()
+	b := bufio.NewWriter(w)
+	for _, p := range CM.Placements(gaps) {
+		c := (*CM.Contigs)[p.Contig]
+		if p.Length == 0 {
+			return fmt.Errorf("unknown length for contig %s", p.Contig)
+		}
+		strand := p.Orientation
+		if strand == "" {
+			strand = "."
+		}
+		var markers []*Marker
+		for _, m := range *c.Markers {
+			if m.LG != CM.Name {
+				continue
+			}
+			if m.ConPos < 0 || m.ConPos >= float64(p.Length) {
+				return fmt.Errorf("marker %s outside contig %s", m.Name, p.Contig)
+			}
+			markers = append(markers, m)
+		}
+		pos := func(m *Marker) uint64 { return uint64(c.pseudoPos(p.Start, m.ConPos)) }
+		sort.Slice(markers, func(i, j int) bool {
+			if pos(markers[i]) != pos(markers[j]) {
+				return pos(markers[i]) < pos(markers[j])
+			}
+			return markers[i].Name < markers[j].Name
+		})
+		for _, m := range markers {
+			score := m.Weight
+			if score > 1000 {
+				score = 1000
+			}
+			fmt.Fprintf(b, "%s\t%d\t%d\t%s:%s\t%d\t%s\n", CM.Name, pos(m), pos(m)+1, m.Name, FormatPos(m.GenPos), score, strand)
+		}
+	}
+	return b.Flush()
+}
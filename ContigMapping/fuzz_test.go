@@ -0,0 +1,239 @@
+package ContigMapping
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Write the maps in the result format, in the order of names
+func writeResult(maps map[string]*ContigMap, names []string) string {
+	var out strings.Builder
+	for _, name := range names {
+		maps[name].WriteMap(&out)
+		out.WriteString("\n")
+	}
+	return out.String()
+}
+
+func FuzzReadResult(f *testing.F) {
+	if golden, err := os.ReadFile(filepath.Join("..", "ContigMapper", "testdata", "test1.out")); err == nil {
+		f.Add(string(golden))
+	}
+	f.Add("## out = \"x\"\n### LG: 1\n### Deleted Sequences: 2\nc1\t1.5\t+\nc2\t1.5\t\treference\n")
+	f.Add("### LG: a\nc1\t0\t-\n### LG: b\n")
+	f.Fuzz(func(t *testing.T, in string) {
+		maps, names, err := ReadResult(strings.NewReader(in))
+		if err != nil {
+			return
+		}
+		first := writeResult(maps, names)
+		maps, names, err = ReadResult(strings.NewReader(first))
+		if err != nil {
+			t.Fatalf("cannot read the written result: %v\n%s", err, first)
+		}
+		if second := writeResult(maps, names); second != first {
+			t.Errorf("result changes when written again:\n%s\n%s", first, second)
+		}
+	})
+}
+
+func FuzzReadResultJSON(f *testing.F) {
+	f.Add(`{"lgs":[{"name":"1","deleted":1,"contigs":[{"name":"c1","position":1.5,"orientation":"+"},{"name":"c2","position":2,"orientation":"","reference":true}]}]}`)
+	f.Add(`{"lgs":[]}`)
+	f.Fuzz(func(t *testing.T, in string) {
+		maps, names, err := ReadResultJSON(strings.NewReader(in))
+		if err != nil {
+			return
+		}
+		var first, second bytes.Buffer
+		if err := WriteResultJSON(&first, maps, names); err != nil {
+			return
+		}
+		maps, names, err = ReadResultJSON(bytes.NewReader(first.Bytes()))
+		if err != nil {
+			t.Fatalf("cannot read the written result: %v\n%s", err, first.String())
+		}
+		if err := WriteResultJSON(&second, maps, names); err != nil || !bytes.Equal(first.Bytes(), second.Bytes()) {
+			t.Errorf("result changes when written again:\n%s\n%s", first.String(), second.String())
+		}
+	})
+}
+
+func FuzzReadAnyResult(f *testing.F) {
+	f.Add("##agp-version 2.0\nlg1\t1\t100\t1\tW\tc1\t1\t100\t+\nlg1\t101\t200\t2\tU\t100\tscaffold\tyes\tmap\n")
+	f.Add("### LG: 1\nc1\t1\t+\n")
+	f.Add(`{"lgs":[{"name":"1","contigs":[{"name":"c1"}]}]}`)
+	f.Add(" \n\t")
+	f.Fuzz(func(t *testing.T, in string) {
+		ReadAnyResult(strings.NewReader(in))
+	})
+}
+
+func FuzzReadLengths(f *testing.F) {
+	f.Add("c1\t1000\t6\t60\t61\nc2\t500\n")
+	f.Fuzz(func(t *testing.T, in string) {
+		ReadLengths(strings.NewReader(in))
+	})
+}
+
+func FuzzIndexFasta(f *testing.F) {
+	f.Add(">c1 description\nACGT\nNNAC\n>c2\nGG\n")
+	f.Add(">c1\r\nACG\r\nT\r\n\n>c2\n>c3\nAC")
+	f.Fuzz(func(t *testing.T, in string) {
+		index, err := IndexFasta(strings.NewReader(in))
+		if err != nil {
+			return
+		}
+		// Every indexed sequence is copied whole with only bases, and reversed it is its reverse complement
+		fasta := NewFasta(strings.NewReader(in), index)
+		for name, e := range index {
+			var forward, reverse strings.Builder
+			if err := fasta.copySequence(&forward, name, false); err != nil || uint64(forward.Len()) != e.Length || !validBases([]byte(forward.String())) {
+				t.Fatalf("%s: copied %q, %v, indexed %+v", name, forward.String(), err, e)
+			}
+			if err := fasta.copySequence(&reverse, name, true); err != nil || reverse.String() != string(ReverseComplement([]byte(forward.String()))) {
+				t.Errorf("%s: reverse copied %q, %v, forward %q", name, reverse.String(), err, forward.String())
+			}
+		}
+	})
+}
+
+func FuzzReadPAF(f *testing.F) {
+	f.Add("c1\t1000\t0\t1000\t+\tchr1\t100000\t500\t1500\t990\t1000\t60\n", uint64(0))
+	f.Fuzz(func(t *testing.T, in string, minQ uint64) {
+		ReadPAF(strings.NewReader(in), minQ)
+	})
+}
+
+func FuzzReadLinks(f *testing.F) {
+	f.Add("c1\tc2\t10\nc2\tc3\t4.5\n")
+	f.Fuzz(func(t *testing.T, in string) {
+		ReadLinks(strings.NewReader(in), "hic")
+	})
+}
+
+func FuzzReadBarcodes(f *testing.F) {
+	f.Add("c1\tAAAC\nc2\tAAAC\nc3\tGGTA\n")
+	f.Fuzz(func(t *testing.T, in string) {
+		ReadBarcodes(strings.NewReader(in))
+	})
+}
+
+func FuzzReadPairs(f *testing.F) {
+	f.Add("## pairs format v1.0\n#chromsize: c1 1000\n#chromsize: c2 500\nr1\tc1\t10\tc2\t400\t+\t-\n")
+	f.Fuzz(func(t *testing.T, in string) {
+		ReadPairs(strings.NewReader(in), map[string]uint64{"c3": 100})
+	})
+}
+
+func FuzzReadEndLinks(f *testing.F) {
+	f.Add("c1\tend\tc2\tstart\t12\n")
+	f.Fuzz(func(t *testing.T, in string) {
+		ReadEndLinks(strings.NewReader(in))
+	})
+}
+
+func FuzzReadLiftoverAGP(f *testing.F) {
+	f.Add("##agp-version 2.0\n1\t1\t50\t1\tW\ta\t1\t50\t+\n1\t51\t150\t2\tN\t100\tscaffold\tyes\tmap\n1\t151\t180\t3\tW\tb\t1\t30\t-\n")
+	f.Fuzz(func(t *testing.T, in string) {
+		ReadLiftoverAGP(strings.NewReader(in))
+	})
+}
+
+// Lift records of any of the formats with a fixed layout. Lifted records must stay in the pseudomolecules
+func FuzzLift(f *testing.F) {
+	f.Add("a\t10\t20\tx\t0\t+\nb\t0\t30\ty\t0\t+\t5\t25\t0\t2\t5,10,\t0,20,\n", uint8(0))
+	f.Add("##gff-version 3\nb\tx\tgene\t1\t30\t.\t+\t.\tID=g\n##FASTA\n>b\nAC\n", uint8(1))
+	f.Add("#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO\nb\t3\t.\tAC\tGT,TT\t.\t.\tEND=4\n", uint8(2))
+	l, err := NewLiftover(liftPlacements())
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Fuzz(func(t *testing.T, in string, format uint8) {
+		run := []func(io.Reader, io.Writer, io.Writer, *RunHeader) (LiftCounts, error){l.LiftBED, l.LiftGFF, l.LiftVCF}[format%3]
+		var out strings.Builder
+		counts, err := run(strings.NewReader(in), &out, io.Discard, testHeader())
+		if err != nil || format%3 != 0 {
+			return
+		}
+		lifted := 0
+		for _, line := range strings.Split(out.String(), "\n") {
+			values := strings.Split(line, "\t")
+			if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "track") || strings.HasPrefix(line, "browser") {
+				continue
+			}
+			lifted++
+			if len(values) < 3 || values[0] != "1" {
+				t.Fatalf("lifted to a wrong pseudomolecule: %q", line)
+			}
+			if end, err := strconv.ParseUint(values[2], 10, 64); err != nil || end > l.Sizes["1"] {
+				t.Errorf("lifted outside the pseudomolecule: %q", line)
+			}
+		}
+		if lifted != counts.Lifted {
+			t.Errorf("%d lifted records written, counted %d", lifted, counts.Lifted)
+		}
+	})
+}
+
+func FuzzReadModel(f *testing.F) {
+	f.Add(`{"version": 1, "maps": [{"name": "1", "markers": [{"name": "m1", "lg": "1", "contig": "a", "genpos": 1, "conpos": 10, "weight": 5}],
+"contigs": [{"name": "a", "lg": "1", "genpos": 1, "range": [{"marker": "m1", "genpos": 1, "weight": 5}, {"genpos": 2, "weight": 5}], "placeable": true,
+"markers": [{"name": "m1", "lg": "1", "contig": "a", "genpos": 1, "conpos": 10, "weight": 5}]}]}]}`)
+	f.Add(`{"name": "1", "filtered": true, "contigs": [{"name": "a", "genpos": 3}]}` + "\n" + `{"name": "2"}`)
+	f.Fuzz(func(t *testing.T, in string) {
+		maps, names, err := ReadModel(strings.NewReader(in))
+		if err != nil {
+			return
+		}
+		var first, second strings.Builder
+		if err := WriteModel(&first, maps, names, false, nil); err != nil {
+			return
+		}
+		maps, names, err = ReadModel(strings.NewReader(first.String()))
+		if err != nil {
+			t.Fatalf("cannot read the written model: %v\n%s", err, first.String())
+		}
+		WriteModel(&second, maps, names, false, nil)
+		if second.String() != first.String() {
+			t.Errorf("model changes when written again:\n%s\n%s", first.String(), second.String())
+		}
+	})
+}
+
+func FuzzReadOverrides(f *testing.F) {
+	f.Add("a\tforce-LG\t2\t1.5\nb\texclude\nc\tpin-before\ta\n")
+	f.Add("# curation\nd\tsplit-at\t100\ne\tforce-orientation\t+")
+	f.Fuzz(func(t *testing.T, in string) {
+		overrides, err := ReadOverrides(strings.NewReader(in))
+		if err != nil {
+			return
+		}
+		// The overrides written back are read the same
+		var out strings.Builder
+		for _, o := range overrides {
+			out.WriteString(o.Contig + "\t" + o.Action)
+			if o.Value != "" {
+				out.WriteString("\t" + o.Value)
+			}
+			if o.HasPos {
+				out.WriteString("\t" + FormatPos(o.Position))
+			}
+			out.WriteString("\n")
+		}
+		again, err := ReadOverrides(strings.NewReader(out.String()))
+		if err != nil || len(again) != len(overrides) {
+			t.Fatalf("cannot read the written overrides: %v\n%s", err, out.String())
+		}
+		for i := range again {
+			if again[i].String() != overrides[i].String() {
+				t.Errorf("override %q read as %q", overrides[i], again[i])
+			}
+		}
+	})
+}